@@ -4,6 +4,10 @@ package ansi
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
 )
 
 // NoColor disables ANSI color output. By default it is set to true if the
@@ -42,6 +46,37 @@ func Bold(s string) string {
 	return "\033[1m" + s + "\033[0m"
 }
 
+// Underline returns a string wrapped in ANSI escape codes to underline it.
+func Underline(s string) string {
+	if NoColor {
+		return s
+	}
+	return "\033[4m" + s + "\033[0m"
+}
+
+// Italic returns a string wrapped in ANSI escape codes to make it italic.
+func Italic(s string) string {
+	if NoColor {
+		return s
+	}
+	return "\033[3m" + s + "\033[0m"
+}
+
+// IsValidColor returns whether i is a valid 256-color ANSI color index.
+func IsValidColor(i int) bool {
+	return i >= 0 && i <= 255
+}
+
+// escapePattern matches ANSI escape sequences, like those for colors and
+// cursor movement.
+var escapePattern = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// Strip returns s with any ANSI escape sequences removed, regardless of
+// NoColor.
+func Strip(s string) string {
+	return escapePattern.ReplaceAllString(s, "")
+}
+
 func ColorStart(i int) string {
 	if NoColor {
 		return ""
@@ -55,3 +90,99 @@ func ColorEnd() string {
 	}
 	return "\033[0m"
 }
+
+// Sprintf formats according to a format specifier like fmt.Sprintf, with
+// extra verbs for styling:
+//
+//	%b	the argument in bold
+//	%d	the argument dimmed
+//	%r	the argument in red
+//	%c	the start of a color, given an int color index
+//
+// Note that %d dims its argument rather than formatting an integer; use %v
+// for integers instead. Other verbs are handled by fmt. All styling is
+// omitted if NoColor is set.
+func Sprintf(format string, a ...interface{}) string {
+	var (
+		f    strings.Builder
+		args []interface{}
+		argi int
+	)
+	nextArg := func() interface{} {
+		if argi >= len(a) {
+			return nil
+		}
+		argi++
+		return a[argi-1]
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			f.WriteByte(format[i])
+			continue
+		}
+		if strings.IndexByte("bdrc", format[i+1]) >= 0 {
+			verb := format[i+1]
+			i++
+			arg := nextArg()
+			s := fmt.Sprint(arg)
+			switch verb {
+			case 'b':
+				s = Bold(s)
+			case 'd':
+				s = Dim(s)
+			case 'r':
+				s = Red(s)
+			case 'c':
+				n, _ := arg.(int)
+				s = ColorStart(n)
+			}
+			f.WriteString(strings.ReplaceAll(s, "%", "%%"))
+			continue
+		}
+		// Copy any other verb through to fmt, along with its flags and the
+		// arguments it uses.
+		j := i + 1
+		for j < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[j]) >= 0 {
+			if format[j] == '*' {
+				args = append(args, nextArg())
+			}
+			j++
+		}
+		f.WriteString(format[i : j+1])
+		if j < len(format) && format[j] != '%' {
+			args = append(args, nextArg())
+		}
+		i = j
+	}
+	return fmt.Sprintf(f.String(), args...)
+}
+
+// Table formats rows as a table with aligned columns. If headers are given,
+// they're printed in bold above the rows, separated from them by a dim rule.
+// Cells should be plain text, since escape codes throw off the alignment.
+func Table(headers []string, rows [][]string) string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if len(headers) > 0 {
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	if len(headers) == 0 {
+		return buf.String()
+	}
+
+	// Style the header after aligning, so its escape codes aren't counted
+	// as part of the column widths.
+	lines := strings.SplitAfter(buf.String(), "\n")
+	width := 0
+	for _, line := range lines {
+		if n := utf8.RuneCountInString(strings.TrimRight(line, " \n")); n > width {
+			width = n
+		}
+	}
+	header := strings.TrimRight(lines[0], " \n")
+	return Bold(header) + "\n" + Dim(strings.Repeat("─", width)) + "\n" + strings.Join(lines[1:], "")
+}
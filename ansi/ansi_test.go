@@ -0,0 +1,92 @@
+package ansi
+
+import "testing"
+
+func TestSprintf(t *testing.T) {
+	tests := []struct {
+		noColor bool
+		format  string
+		args    []interface{}
+		want    string
+	}{
+		{true, "%b: %v", []interface{}{"Error", 3}, "Error: 3"},
+		{true, "%s %d %r %c%s", []interface{}{"a", "b", "c", 5, "d"}, "a b c d"},
+		{true, "100%% %5.1f", []interface{}{1.25}, "100%   1.2"},
+		{false, "%b %d", []interface{}{"a", "b"}, "\033[1ma\033[0m \033[0;2mb\033[0m"},
+		{false, "%c%s", []interface{}{2, "a"}, "\033[0;38;5;2ma"},
+	}
+
+	for _, tt := range tests {
+		NoColor = tt.noColor
+		got := Sprintf(tt.format, tt.args...)
+		if got != tt.want {
+			t.Errorf("Sprintf(%q, %v) = %q, want %q", tt.format, tt.args, got, tt.want)
+		}
+	}
+	NoColor = false
+}
+
+func TestStyles(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   func(string) string
+		noColor bool
+		want    string
+	}{
+		{"Underline", Underline, false, "\033[4mtext\033[0m"},
+		{"Underline", Underline, true, "text"},
+		{"Italic", Italic, false, "\033[3mtext\033[0m"},
+		{"Italic", Italic, true, "text"},
+		{"Bold", Bold, false, "\033[1mtext\033[0m"},
+		{"Bold", Bold, true, "text"},
+	}
+
+	for _, tt := range tests {
+		NoColor = tt.noColor
+		if got := tt.style("text"); got != tt.want {
+			t.Errorf("%s(%q) with NoColor %v = %q, want %q", tt.name, "text", tt.noColor, got, tt.want)
+		}
+	}
+	NoColor = false
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"plain", "plain"},
+		{"\033[0;31mred\033[0m", "red"},
+		{"\033[0;38;5;8mgray\033[0m text", "gray text"},
+		{"\033[2K\033[1Gprogress", "progress"},
+		{"\033]0;title\007after", "after"},
+	}
+
+	for _, tt := range tests {
+		if got := Strip(tt.input); got != tt.want {
+			t.Errorf("Strip(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	NoColor = true
+	defer func() { NoColor = false }()
+
+	got := Table([]string{"NAME", "STATUS"}, [][]string{
+		{"api", "running"},
+		{"worker-long", "exited"},
+	})
+	want := "NAME         STATUS\n" +
+		"────────────────────\n" +
+		"api          running\n" +
+		"worker-long  exited\n"
+	if got != want {
+		t.Errorf("Table() = %q, want %q", got, want)
+	}
+
+	got = Table(nil, [][]string{{"a", "b"}, {"ccc", "d"}})
+	want = "a    b\nccc  d\n"
+	if got != want {
+		t.Errorf("Table() without headers = %q, want %q", got, want)
+	}
+}
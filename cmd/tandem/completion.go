@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// cmdPrefixes are the command prefixes suggested when completing arguments.
+var cmdPrefixes = []string{"npm:", "bun:", "npx:", "workspace:"}
+
+// pathFlags are flags whose values are completed as paths by the shell.
+var pathFlags = []string{"-d", "--directory", "--config", "--log-dir", "--lock-file", "--ignore-patterns", "--ignore-file", "--control-socket"}
+
+// completionCommand prints a completion script for the given shell, which
+// calls back into tandem with --generate-bash-completion to get suggestions.
+var completionCommand = &cli.Command{
+	Name:      "completion",
+	Usage:     "print a shell completion script for bash, zsh, or fish",
+	ArgsUsage: "bash|zsh|fish",
+	Action: func(c *cli.Context) error {
+		switch shell := c.Args().First(); shell {
+		case "bash":
+			fmt.Print(strings.ReplaceAll(bashCompletion, "$PROG", c.App.Name))
+		case "zsh":
+			fmt.Print(strings.ReplaceAll(zshCompletion, "$PROG", c.App.Name))
+		case "fish":
+			s, err := c.App.ToFishCompletion()
+			if err != nil {
+				return fmt.Errorf("generating fish completion: %v", err)
+			}
+			fmt.Print(s)
+		default:
+			return fmt.Errorf("unsupported shell %q, expected bash, zsh, or fish", shell)
+		}
+		return nil
+	},
+}
+
+// completeArgs suggests flags when completing something starting with '-',
+// and command prefixes otherwise. Nothing is suggested for path flags, so the
+// shell falls back to completing files.
+func completeArgs(c *cli.Context) {
+	if len(os.Args) > 2 {
+		prev := os.Args[len(os.Args)-2]
+		for _, flag := range pathFlags {
+			if prev == flag {
+				return
+			}
+		}
+		if strings.HasPrefix(prev, "-") {
+			cli.DefaultAppComplete(c)
+			return
+		}
+	}
+	for _, prefix := range cmdPrefixes {
+		fmt.Fprintln(c.App.Writer, prefix)
+	}
+	fmt.Fprintln(c.App.Writer, completionCommand.Name)
+	fmt.Fprintln(c.App.Writer, ctlCommand.Name)
+}
+
+const bashCompletion = `_$PROG_complete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion )
+  else
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+  return 0
+}
+
+complete -o bashdefault -o default -o nospace -F _$PROG_complete $PROG
+`
+
+const zshCompletion = `#compdef $PROG
+
+_$PROG_complete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion)}")
+  else
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _$PROG_complete $PROG
+`
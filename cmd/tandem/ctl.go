@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rosszurowski/tandem/ansi"
+	"github.com/urfave/cli/v2"
+)
+
+// ctlCommand sends commands to a running tandem through its control socket,
+// which it listens on when run with --control-socket.
+var ctlCommand = &cli.Command{
+	Name:  "ctl",
+	Usage: "control a running tandem through its control socket",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "socket",
+			Usage: "`path` of the control socket tandem was run with",
+			Value: ".tandem.sock",
+		},
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:      "tail",
+			Usage:     "print the last lines of a command's output, then follow it until interrupted",
+			ArgsUsage: "<name>",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:    "lines",
+					Aliases: []string{"n"},
+					Usage:   "number of recent `lines` to print first, rather than every line kept",
+					Value:   -1,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("expected the name of a command, like: tandem ctl tail api")
+				}
+				command := "TAIL " + c.Args().First()
+				if n := c.Int("lines"); n >= 0 {
+					command += " " + strconv.Itoa(n)
+				}
+				conn, r, err := dialControl(c.String("socket"), command)
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				_, err = io.Copy(os.Stdout, r)
+				return err
+			},
+		},
+		{
+			Name:      "signal",
+			Usage:     "send a signal to every running command in a group",
+			ArgsUsage: "<group> <signal>",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 2 {
+					return fmt.Errorf("expected a group and a signal, like: tandem ctl signal backend SIGHUP")
+				}
+				conn, _, err := dialControl(c.String("socket"), "SIGNAL group:"+c.Args().Get(0)+" "+c.Args().Get(1))
+				if err != nil {
+					return err
+				}
+				return conn.Close()
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "list each command with its status and how many times it's been restarted",
+			Action: func(c *cli.Context) error {
+				conn, r, err := dialControl(c.String("socket"), "STATUS")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				var rows [][]string
+				for {
+					line, err := r.ReadString('\n')
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						return fmt.Errorf("reading status from tandem: %v", err)
+					}
+					rows = append(rows, strings.Split(strings.TrimRight(line, "\n"), "\t"))
+				}
+				fmt.Fprint(c.App.Writer, ansi.Table([]string{"NAME", "STATUS", "RESTARTS"}, rows))
+				return nil
+			},
+		},
+		{
+			Name:      "pause",
+			Usage:     "stop a running command until it's resumed",
+			ArgsUsage: "<name>",
+			Action: func(c *cli.Context) error {
+				return sendName(c, "PAUSE")
+			},
+		},
+		{
+			Name:      "resume",
+			Usage:     "continue a paused command",
+			ArgsUsage: "<name>",
+			Action: func(c *cli.Context) error {
+				return sendName(c, "RESUME")
+			},
+		},
+	},
+}
+
+// sendName sends a command that takes the name of a process, like PAUSE, to
+// the control socket.
+func sendName(c *cli.Context, command string) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected the name of a command, like: tandem ctl %s api", c.Command.Name)
+	}
+	conn, _, err := dialControl(c.String("socket"), command+" "+c.Args().First())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// dialControl connects to the control socket at path and sends a command,
+// returning the connection once tandem replies that the command succeeded,
+// along with a reader for the rest of the reply.
+func dialControl(path, command string) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't connect to tandem, is it running with --control-socket %s? %v", path, err)
+	}
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("reading reply from tandem: %v", err)
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "OK" {
+		conn.Close()
+		return nil, nil, errors.New(strings.TrimPrefix(reply, "ERR "))
+	}
+	return conn, r, nil
+}
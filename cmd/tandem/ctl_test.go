@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rosszurowski/tandem/ansi"
+	"github.com/urfave/cli/v2"
+)
+
+// fakeControl listens on a control socket that answers each command with
+// reply, sending the commands it receives on the returned channel.
+func fakeControl(t *testing.T, reply string) (string, <-chan string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	commands := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			commands <- strings.TrimSpace(line)
+			fmt.Fprint(conn, reply)
+			conn.Close()
+		}
+	}()
+	return path, commands
+}
+
+// runCtl runs tandem ctl with args, returning what it wrote.
+func runCtl(path string, args ...string) (string, error) {
+	var buf bytes.Buffer
+	app := &cli.App{Commands: []*cli.Command{ctlCommand}, Writer: &buf}
+	err := app.Run(append([]string{"tandem", "ctl", "--socket", path}, args...))
+	return buf.String(), err
+}
+
+func TestCtlStatus(t *testing.T) {
+	ansi.NoColor = true
+	path, commands := fakeControl(t, "OK\napi\trunning\t2\nworker\texited 1\t0\n")
+	out, err := runCtl(path, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-commands; got != "STATUS" {
+		t.Fatalf("sent %q, want STATUS", got)
+	}
+	want := "NAME    STATUS    RESTARTS\n" + strings.Repeat("─", 26) + "\napi     running   2\nworker  exited 1  0\n"
+	if out != want {
+		t.Fatalf("got status %q, want %q", out, want)
+	}
+
+	path, _ = fakeControl(t, "ERR nope\n")
+	if _, err := runCtl(path, "status"); err == nil || err.Error() != "nope" {
+		t.Fatalf("expected tandem's error to be returned, got %v", err)
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rosszurowski/tandem/ansi"
 	"github.com/rosszurowski/tandem/tandem"
@@ -18,23 +25,36 @@ var (
 
 func main() {
 	cwd, cwdErr := os.Getwd()
+	// The run's exit code, and where to write it, are kept so tandem exits
+	// with the same code it writes, even if it fails before running.
+	var code int
+	var exitCodeFile string
 	app := &cli.App{
 		Name:    name,
 		Version: version,
 		Usage:   "Run multiple commands in tandem",
+		Commands: []*cli.Command{
+			completionCommand,
+			ctlCommand,
+		},
+		EnableBashCompletion: true,
+		BashComplete:         completeArgs,
 		Flags: []cli.Flag{
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:        "directory",
 				Aliases:     []string{"d"},
-				Usage:       "`path` to run commands from",
-				Value:       cwd,
+				Usage:       "`path` to run commands from, or name=path to set one command's directory (can be repeated)",
 				DefaultText: "cwd",
-				Action: func(ctx *cli.Context, v string) error {
-					if v == "" && cwdErr != nil {
-						return fmt.Errorf("could not get current working directory: %v", cwdErr)
-					}
-					return nil
-				},
+			},
+			&cli.BoolFlag{
+				Name:  "name-from-dir",
+				Usage: "label config file processes that set a dir but no name with their directory's name",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "`path` to a tandem.yaml config file (searched for if no commands are given)",
 			},
 			&cli.IntFlag{
 				Name:  "timeout",
@@ -50,31 +70,577 @@ func main() {
 					return nil
 				},
 			},
+			&cli.StringFlag{
+				Name:  "kill-signal",
+				Value: "SIGKILL",
+				Usage: "`signal` sent to commands that haven't exited after the timeout (SIGKILL, SIGTERM, or SIGQUIT)",
+				Action: func(ctx *cli.Context, v string) error {
+					if _, err := tandem.ParseKillSignal(v); err != nil {
+						return fmt.Errorf("--kill-signal: %v", err)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "interrupt-signal",
+				Value: "SIGINT",
+				Usage: "`signal` sent to ask commands to exit gracefully (SIGINT, SIGTERM, SIGQUIT, SIGHUP, SIGUSR1, or SIGUSR2)",
+				Action: func(ctx *cli.Context, v string) error {
+					if _, err := tandem.ParseInterruptSignal(v); err != nil {
+						return fmt.Errorf("--interrupt-signal: %v", err)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:  "timeout-kill",
+				Usage: "after the timeout, send SIGTERM and wait this many `seconds` more before killing commands",
+				Value: 0,
+				Action: func(ctx *cli.Context, v int) error {
+					if v < 0 {
+						return fmt.Errorf("--timeout-kill value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "timeout-per-process",
+				Usage: "per-command timeouts as comma-separated `name=seconds` pairs, overriding --timeout",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ports",
+				Usage: "set the PORT environment variable of a command, as `name=port` (can be repeated)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ready-string",
+				Usage: "mark a command as ready once its output contains a string, as `name=string` (can be repeated)",
+			},
+			&cli.StringFlag{
+				Name:  "ignore-exit-codes",
+				Usage: "treat the comma-separated exit `codes` as clean exits",
+			},
+			&cli.StringSliceFlag{
+				Name:  "user",
+				Usage: "run a command as another Unix user, as `name=user` (can be repeated; needs root)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ready-port",
+				Usage: "mark a command as ready once a TCP port on 127.0.0.1 opens, as `name=port` (can be repeated)",
+			},
+			&cli.IntFlag{
+				Name:  "max-line-length",
+				Value: 0,
+				Usage: "truncate output lines longer than `chars`, counting their prefix but not color codes (0 for unlimited)",
+				Action: func(ctx *cli.Context, v int) error {
+					if v < 0 {
+						return fmt.Errorf("--max-line-length value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:  "output-width",
+				Value: 0,
+				Usage: "wrap output lines at `columns` wide, including the command name (0 for no wrapping)",
+			},
+			&cli.StringFlag{
+				Name:  "on-all-exit",
+				Usage: "shell `command` to run once all commands have exited, like for cleanup",
+			},
+			&cli.StringFlag{
+				Name:  "on-first-exit",
+				Usage: "shell `command` to run when the first command exits, given TANDEM_PROC_NAME and TANDEM_EXIT_CODE",
+			},
+			&cli.StringSliceFlag{
+				Name:  "output-filter",
+				Usage: "only show output lines matching `regex` (repeatable)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "output-exclude",
+				Usage: "hide output lines matching `regex` (repeatable)",
+			},
+			&cli.DurationFlag{
+				Name:  "watchdog-timeout",
+				Usage: "restart commands that produce no output for `duration` (e.g. 30s)",
+				Action: func(ctx *cli.Context, v time.Duration) error {
+					if v < 0 {
+						return fmt.Errorf("--watchdog-timeout value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.DurationFlag{
+				Name:  "heartbeat-interval",
+				Usage: "print which commands are still running every `duration` (e.g. 30s)",
+				Action: func(ctx *cli.Context, v time.Duration) error {
+					if v < 0 {
+						return fmt.Errorf("--heartbeat-interval value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "serve each command's memory and CPU usage at /metrics on `addr` (e.g. localhost:9090)",
+			},
+			&cli.DurationFlag{
+				Name:  "metrics-interval",
+				Usage: "how often memory and CPU usage is sampled for --metrics-addr",
+				Value: 5 * time.Second,
+				Action: func(ctx *cli.Context, v time.Duration) error {
+					if v <= 0 {
+						return fmt.Errorf("--metrics-interval value must be above 0, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "exec-shell-env",
+				Usage: "run commands with the shell from $SHELL, rather than /bin/sh",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "ordered-output",
+				Usage: "buffer output briefly and write each batch sorted by command name",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "sort-by-name",
+				Usage: "start commands in alphabetical order of their names, rather than the order given",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "shutdown-grace-message",
+				Usage: "`message` printed when asking a command to exit, with {name} and {timeout} placeholders",
+			},
+			&cli.DurationFlag{
+				Name:  "start-timeout",
+				Usage: "warn about commands that produce no output within `duration` of starting (e.g. 10s)",
+				Action: func(ctx *cli.Context, v time.Duration) error {
+					if v < 0 {
+						return fmt.Errorf("--start-timeout value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "start-timeout-kill",
+				Usage: "kill commands that hit --start-timeout, rather than only warning",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "npx-args",
+				Usage: "extra `args` to pass to npx for 'npx:' commands (e.g. --npx-args=--yes)",
+			},
+			&cli.BoolFlag{
+				Name:  "race-detect",
+				Usage: "run Go commands like 'go run' and 'go test' with the race detector",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "bun-args",
+				Usage: "extra `args` to pass to 'bun run' for 'bun:' commands",
+			},
+			&cli.BoolFlag{
+				Name:  "restart",
+				Usage: "restart commands that exit with an error",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "restart-on-exit",
+				Usage: "restart commands whenever they exit, even successfully",
+				Value: false,
+			},
+			&cli.IntFlag{
+				Name:  "max-output-rate",
+				Value: 0,
+				Usage: "maximum `lines` per second of output to show for each command, dropping the rest (0 for unlimited)",
+				Action: func(ctx *cli.Context, v int) error {
+					if v < 0 {
+						return fmt.Errorf("--max-output-rate value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:  "max-restarts",
+				Usage: "maximum `number` of times to restart each command (0 for unlimited)",
+				Value: 0,
+				Action: func(ctx *cli.Context, v int) error {
+					if v < 0 {
+						return fmt.Errorf("--max-restarts value must be 0 or above, got %v", v)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "max-restart-rate",
+				Usage: "give up restarting a command once it's restarted more than `N/duration`, like 3/60s",
+			},
+			&cli.StringSliceFlag{
+				Name:  "group",
+				Usage: "tag commands with a group, as `name=cmd1,cmd2` (can be repeated)",
+			},
+			&cli.BoolFlag{
+				Name:  "interleave-stderr",
+				Usage: "write stderr through the same terminal as stdout (set to false to print stderr separately in red)",
+				Value: true,
+			},
+			&cli.IntFlag{
+				Name:  "color-stderr",
+				Usage: "ANSI `color` index for stderr lines and errors, rather than red, or -1 for each command's own color",
+			},
+			&cli.BoolFlag{
+				Name:  "only-explicit",
+				Usage: "only expand npm wildcards to scripts in the config file's allowed_scripts",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:        "ignore-patterns",
+				Aliases:     []string{"ignore-file"},
+				Usage:       "`path` to a file of npm script patterns that wildcards never expand to",
+				DefaultText: ".tandemignore",
+			},
+			&cli.BoolFlag{
+				Name:  "no-package-json-walk",
+				Usage: "only read package.json from the directory, not its parents",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "skip-missing-scripts",
+				Usage: "skip workspaces without the script given to 'workspace:' commands, rather than failing",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "inject-version",
+				Usage: "set APP_VERSION for commands to the version in package.json",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "env-inherit",
+				Usage: "pass tandem's environment to commands (set to false to only pass PATH and config file variables)",
+				Value: true,
+			},
+			&cli.BoolFlag{
+				Name:  "nvm",
+				Usage: "use the node version from .nvmrc or .node-version, installed with nvm",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:        "lock-file",
+				Usage:       "`path` to write a JSON file describing tandem to while it runs",
+				DefaultText: ".tandem.lock",
+			},
+			&cli.StringFlag{
+				Name:  "control-socket",
+				Usage: "`path` of a Unix socket to accept commands from tandem ctl on while running, like .tandem.sock",
+			},
+			&cli.StringFlag{
+				Name:  "exit-code-file",
+				Usage: "`path` to write the exit code of the first command to fail to, or 128+signal if interrupted, once everything exits",
+			},
+			&cli.BoolFlag{
+				Name:  "no-lock-file",
+				Usage: "don't write a lock file while running",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "log-dir",
+				Usage: "also write each command's output to a file in `dir`",
+			},
+			&cli.StringFlag{
+				Name:  "log-format",
+				Usage: "`format` of lines in --log-dir files: text or json",
+				Value: "text",
+			},
+			&cli.BoolFlag{
+				Name:  "exec",
+				Usage: "run commands directly rather than through /bin/sh",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "no-exit",
+				Usage: "keep running after commands exit, until interrupted",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "no-node-bin",
+				Usage: "don't add node_modules/.bin to the PATH of commands",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "stdin",
+				Usage: "forward input to the command with the given `name`",
+			},
+			&cli.BoolFlag{
+				Name:  "stdin-broadcast",
+				Usage: "forward input to every command at once",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "prepend-name-to-stdin",
+				Usage: "echo input forwarded with --stdin or --stdin-broadcast, labelled with the command's name",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "stdin-cmds",
+				Usage: "read additional commands from stdin, one per line",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "pipe",
+				Usage: "start each line read from stdin as a command as soon as it's read, until stdin closes and every command exits",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "color-by-hash",
+				Usage: "pick label colors from a hash of each command's name, so they're stable between runs",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "watch-config",
+				Usage: "reload the config file when it changes, restarting, starting, or stopping processes to match it",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print the commands that would be run, without running them",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "no-banner",
+				Usage: "don't print a summary of commands before starting them",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "prefix-separator",
+				Usage: "`string` to print between each command's name and its output (default: a space)",
+			},
+			&cli.StringFlag{
+				Name:  "prefix-style",
+				Value: "color",
+				Usage: "`style` of the name labelling each line: color, dim, or none",
+				Action: func(ctx *cli.Context, v string) error {
+					switch v {
+					case "color", "dim", "none":
+						return nil
+					}
+					return fmt.Errorf("--prefix-style value must be color, dim, or none, got %q", v)
+				},
+			},
 			&cli.BoolFlag{
 				Name:  "silent",
 				Usage: "silence non-command output",
 				Value: false,
 			},
 		},
+		// Flags are checked after Before, so invalid values are still
+		// written to the exit code file.
+		Before: func(c *cli.Context) error {
+			exitCodeFile = c.String("exit-code-file")
+			return nil
+		},
 		Action: func(c *cli.Context) error {
-			args := c.Args()
-			if args.Len() < 1 {
+			cmds := c.Args().Slice()
+			if c.Bool("stdin-cmds") && c.IsSet("stdin") {
+				return fmt.Errorf("--stdin and --stdin-cmds can't be used together")
+			}
+			if c.Bool("stdin-broadcast") && (c.IsSet("stdin") || c.Bool("stdin-cmds")) {
+				return fmt.Errorf("--stdin-broadcast can't be used with --stdin or --stdin-cmds")
+			}
+			if c.Bool("pipe") && (c.Bool("stdin-cmds") || c.IsSet("stdin") || c.Bool("stdin-broadcast")) {
+				return fmt.Errorf("--pipe can't be used with --stdin, --stdin-broadcast, or --stdin-cmds")
+			}
+			if c.Bool("stdin-cmds") {
+				stdinCmds, err := readCmds(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("reading commands from stdin: %v", err)
+				}
+				cmds = append(cmds, stdinCmds...)
+			}
+			root, dirs, err := parseDirectories(c.StringSlice("directory"))
+			if err != nil {
+				return err
+			}
+			rootSet := root != ""
+			if !rootSet {
+				if cwdErr != nil {
+					return fmt.Errorf("could not get current working directory: %v", cwdErr)
+				}
+				root = cwd
+			}
+			if exitCodeFile != "" && !filepath.IsAbs(exitCodeFile) {
+				exitCodeFile = filepath.Join(root, exitCodeFile)
+			}
+			configPath := c.String("config")
+			if configPath == "" && len(cmds) < 1 && !c.Bool("pipe") {
+				path, err := tandem.FindConfigFile(root)
+				if err != nil {
+					return fmt.Errorf("searching for config file: %v", err)
+				}
+				configPath = path
+			}
+			var fileCfg tandem.Config
+			if configPath != "" {
+				cfg, err := tandem.LoadYAMLConfig(configPath)
+				if err != nil {
+					return err
+				}
+				fileCfg = cfg
+				if !rootSet {
+					root = cfg.Root
+				}
+			}
+			if len(cmds) < 1 && len(fileCfg.Processes) < 1 && !c.Bool("pipe") {
+				if configPath != "" {
+					return fmt.Errorf("%s found but defines no processes", filepath.Base(configPath))
+				}
 				return ErrNoCommands
 			}
-			pm, err := tandem.New(tandem.Config{
-				Cmds:    args.Slice(),
-				Root:    c.String("directory"),
-				Timeout: c.Int("timeout"),
-				Silent:  c.Bool("silent"),
-			})
+			filters, err := compilePatterns("output-filter", c.StringSlice("output-filter"))
+			if err != nil {
+				return err
+			}
+			excludes, err := compilePatterns("output-exclude", c.StringSlice("output-exclude"))
+			if err != nil {
+				return err
+			}
+			timeouts, err := parseTimeouts(c.String("timeout-per-process"))
+			if err != nil {
+				return err
+			}
+			ports, err := parsePorts("ports", c.StringSlice("ports"))
+			if err != nil {
+				return err
+			}
+			readyPorts, err := parsePorts("ready-port", c.StringSlice("ready-port"))
 			if err != nil {
 				return err
 			}
-			pm.Run()
+			readyStrings, err := parseNamedStrings("ready-string", c.StringSlice("ready-string"))
+			if err != nil {
+				return err
+			}
+			users, err := parseNamedStrings("user", c.StringSlice("user"))
+			if err != nil {
+				return err
+			}
+			ignoreCodes, err := parseExitCodes(c.String("ignore-exit-codes"))
+			if err != nil {
+				return err
+			}
+			rateRestarts, rateWindow, err := parseRestartRate(c.String("max-restart-rate"))
+			if err != nil {
+				return err
+			}
+			groups, err := parseGroups(c.StringSlice("group"))
+			if err != nil {
+				return err
+			}
+			var shell string
+			if c.Bool("exec-shell-env") {
+				shell = tandem.UserShell()
+			}
+			var stderrColor *int
+			if c.IsSet("color-stderr") {
+				color := c.Int("color-stderr")
+				stderrColor = &color
+			}
+			cfg := tandem.Config{
+				Cmds:                        cmds,
+				Shell:                       shell,
+				Processes:                   fileCfg.Processes,
+				Root:                        root,
+				Timeout:                     c.Int("timeout"),
+				KillTimeout:                 c.Int("timeout-kill"),
+				Silent:                      c.Bool("silent"),
+				MaxLineLength:               c.Int("max-line-length"),
+				MaxOutputRate:               c.Int("max-output-rate"),
+				OutputWidth:                 c.Int("output-width"),
+				OutputFilter:                filters,
+				OutputExclude:               excludes,
+				WatchdogTimeout:             c.Duration("watchdog-timeout"),
+				HeartbeatInterval:           c.Duration("heartbeat-interval"),
+				MetricsAddr:                 c.String("metrics-addr"),
+				MetricsInterval:             c.Duration("metrics-interval"),
+				StartTimeout:                c.Duration("start-timeout"),
+				StartTimeoutKill:            c.Bool("start-timeout-kill"),
+				OrderedOutput:               c.Bool("ordered-output"),
+				SortByName:                  c.Bool("sort-by-name"),
+				ShutdownMessages:            tandem.ShutdownMessages{Interrupting: c.String("shutdown-grace-message")},
+				Timeouts:                    timeouts,
+				NpxArgs:                     strings.Fields(c.String("npx-args")),
+				BunArgs:                     strings.Fields(c.String("bun-args")),
+				RestartOnError:              c.Bool("restart") || c.Bool("restart-on-exit"),
+				RestartOnCleanExit:          c.Bool("restart-on-exit"),
+				MaxRestarts:                 c.Int("max-restarts"),
+				MaxRestartWindow:            rateWindow,
+				MaxRestartsPerWindow:        rateRestarts,
+				SeparateStderr:              !c.Bool("interleave-stderr"),
+				StderrColor:                 stderrColor,
+				DisableNodeBin:              c.Bool("no-node-bin"),
+				StdinProcess:                c.String("stdin"),
+				StdinBroadcast:              c.Bool("stdin-broadcast"),
+				PrependNameToStdin:          c.Bool("prepend-name-to-stdin"),
+				NoBanner:                    c.Bool("no-banner"),
+				ColorByHash:                 c.Bool("color-by-hash"),
+				NoPackageJSONWalk:           c.Bool("no-package-json-walk"),
+				InjectPackageVersion:        c.Bool("inject-version"),
+				SkipMissingWorkspaceScripts: c.Bool("skip-missing-scripts"),
+				KillSignal:                  c.String("kill-signal"),
+				InterruptSignal:             c.String("interrupt-signal"),
+				PrefixStyle:                 c.String("prefix-style"),
+				PrefixSeparator:             c.String("prefix-separator"),
+				UseNvm:                      c.Bool("nvm"),
+				NoAutoExit:                  c.Bool("no-exit"),
+				Exec:                        c.Bool("exec"),
+				LogDir:                      c.String("log-dir"),
+				LogFormat:                   c.String("log-format"),
+				LockFilePath:                c.String("lock-file"),
+				NoLockFile:                  c.Bool("no-lock-file"),
+				ControlSocket:               c.String("control-socket"),
+				ExitCodeFile:                c.String("exit-code-file"),
+				Groups:                      groups,
+				OnAllExit:                   c.String("on-all-exit"),
+				OnFirstExit:                 c.String("on-first-exit"),
+				Ports:                       ports,
+				ReadyStrings:                readyStrings,
+				Users:                       users,
+				Dirs:                        dirs,
+				NameFromDir:                 c.Bool("name-from-dir"),
+				IgnoreExitCodes:             ignoreCodes,
+				ReadyPorts:                  readyPorts,
+				NoInheritEnv:                !c.Bool("env-inherit"),
+				AllowedScripts:              fileCfg.AllowedScripts,
+				IgnoreFile:                  c.String("ignore-patterns"),
+				OnlyNamed:                   c.Bool("only-explicit"),
+				RaceDetect:                  c.Bool("race-detect"),
+			}
+			pm, err := tandem.New(cfg)
+			if err != nil {
+				return err
+			}
+			if c.Bool("dry-run") {
+				pm.DryRun()
+				return nil
+			}
+			if c.Bool("watch-config") {
+				if configPath == "" {
+					return fmt.Errorf("--watch-config needs a config file")
+				}
+				go watchConfig(configPath, pm, cfg)
+			}
+			if c.Bool("pipe") {
+				pm.RunPipe(os.Stdin)
+			} else {
+				pm.Run()
+			}
+			code = pm.RunExitCode()
 			return nil
 		},
-		HideHelpCommand:       true,
-		CustomAppHelpTemplate: usage,
+		HideHelpCommand:           true,
+		DisableSliceFlagSeparator: true,
+		CustomAppHelpTemplate:     usage,
 	}
 
 	sort.Sort(cli.FlagsByName(app.Flags))
@@ -85,12 +651,195 @@ func main() {
 		} else {
 			fmt.Fprintf(os.Stderr, "%s %v\n", ansi.Red("Error:"), err)
 		}
+		if exitCodeFile != "" {
+			if err := os.WriteFile(exitCodeFile, []byte("1\n"), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "tandem: warning: writing exit code file: %v\n", err)
+			}
+		}
 		os.Exit(1)
 	}
+	os.Exit(code)
+}
+
+// readCmds reads newline-separated commands from r, skipping blank lines and
+// lines starting with '#'.
+func readCmds(r io.Reader) ([]string, error) {
+	var cmds []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cmds = append(cmds, line)
+	}
+	return cmds, scanner.Err()
+}
+
+// parseTimeouts parses a comma-separated list of "name=seconds" pairs, like
+// "api=30,css=0".
+func parseTimeouts(s string) (map[string]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	timeouts := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--timeout-per-process value must be in name=seconds format, got %q", pair)
+		}
+		v, err := strconv.Atoi(val)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("--timeout-per-process value for %q must be a number of seconds, got %q", name, val)
+		}
+		timeouts[name] = v
+	}
+	return timeouts, nil
+}
+
+// parsePorts parses name=port pairs given to the flag with the given name.
+func parsePorts(flag string, pairs []string) (map[string]int, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	ports := map[string]int{}
+	for _, pair := range pairs {
+		name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--%s value must be in name=port format, got %q", flag, pair)
+		}
+		if _, ok := ports[name]; ok {
+			return nil, fmt.Errorf("--%s given more than once for %q", flag, name)
+		}
+		v, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("--%s value for %q must be a port number, got %q", flag, name, val)
+		}
+		ports[name] = v
+	}
+	return ports, nil
+}
+
+// parseRestartRate parses a restart rate limit like "3/60s", for at most 3
+// restarts in 60 seconds. An empty string means no limit.
+func parseRestartRate(s string) (int, time.Duration, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	count, window, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("invalid --max-restart-rate %q, expected N/duration like 3/60s", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("invalid --max-restart-rate %q, expected N/duration like 3/60s", s)
+	}
+	return n, d, nil
+}
+
+// parseDirectories parses the values given to --directory. A plain path sets
+// the root directory, which can only be given once, and name=path pairs set
+// the directories of individual commands.
+func parseDirectories(values []string) (string, map[string]string, error) {
+	var root string
+	var dirs map[string]string
+	for _, v := range values {
+		name, path, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			if root != "" {
+				return "", nil, fmt.Errorf("--directory given more than once without a command name")
+			}
+			root = v
+			continue
+		}
+		if path == "" {
+			return "", nil, fmt.Errorf("--directory value must be a path or in name=path format, got %q", v)
+		}
+		if dirs == nil {
+			dirs = map[string]string{}
+		}
+		if _, ok := dirs[name]; ok {
+			return "", nil, fmt.Errorf("--directory given more than once for %q", name)
+		}
+		dirs[name] = path
+	}
+	return root, dirs, nil
+}
+
+// parseExitCodes parses the comma-separated exit codes given to
+// --ignore-exit-codes.
+func parseExitCodes(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var codes []int
+	for _, v := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("--ignore-exit-codes value must be comma-separated numbers, got %q", s)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// parseNamedStrings parses name=string pairs given to the flag with the given
+// name.
+func parseNamedStrings(flag string, pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	values := map[string]string{}
+	for _, pair := range pairs {
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || val == "" {
+			return nil, fmt.Errorf("--%s value must be in name=string format, got %q", flag, pair)
+		}
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("--%s given more than once for %q", flag, name)
+		}
+		values[name] = val
+	}
+	return values, nil
+}
+
+// parseGroups parses name=cmd1,cmd2 values given to --group.
+func parseGroups(values []string) (map[string][]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	groups := map[string][]string{}
+	for _, v := range values {
+		name, procs, ok := strings.Cut(v, "=")
+		if !ok || name == "" || procs == "" {
+			return nil, fmt.Errorf("--group value must be in name=cmd1,cmd2 format, got %q", v)
+		}
+		for _, proc := range strings.Split(procs, ",") {
+			if proc = strings.TrimSpace(proc); proc != "" {
+				groups[name] = append(groups[name], proc)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// compilePatterns compiles a list of regular expressions given to the flag
+// with the given name.
+func compilePatterns(flag string, patterns []string) ([]*regexp.Regexp, error) {
+	var result []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s pattern %q: %v", flag, p, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
 }
 
 var (
-	ErrNoCommands = fmt.Errorf("no commands given")
+	ErrNoCommands = fmt.Errorf("no commands given — run 'tandem --help' for usage")
 
 	usage = fmt.Sprintf(`
   %s {{if .VisibleFlags}}[options]{{end}}{{if .ArgsUsage}}{{.ArgsUsage}}{{else}} <arguments...>{{end}}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestReadCmds(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"npm:dev\n", []string{"npm:dev"}},
+		{"npm:dev\nnpm:css", []string{"npm:dev", "npm:css"}},
+		{"  go run .  \n\n\t\n", []string{"go run ."}},
+		{"# comment\nnpm:dev\n  # indented comment", []string{"npm:dev"}},
+		{"echo '#not a comment'\r\n", []string{"echo '#not a comment'"}},
+	}
+	for _, tt := range tests {
+		got, err := readCmds(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("readCmds(%q): %v", tt.input, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("readCmds(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]int
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"api=30", map[string]int{"api": 30}, false},
+		{"api=30, css=0", map[string]int{"api": 30, "css": 0}, false},
+		{"api=30,api=10", map[string]int{"api": 10}, false},
+		{"api", nil, true},
+		{"=30", nil, true},
+		{"api=soon", nil, true},
+		{"api=-1", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeouts(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTimeouts(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTimeouts(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
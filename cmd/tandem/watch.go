@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/rosszurowski/tandem/tandem"
+)
+
+// configSettleDelay is how long --watch-config waits after the config file
+// changes before reloading it, since editors often save in several steps.
+const configSettleDelay = 100 * time.Millisecond
+
+// watchConfig watches the config file at path, reloading pm with the
+// processes from it whenever it changes. Problems watching or reading the file
+// are warned about in the output, and the running processes are left as they
+// are.
+func watchConfig(path string, pm *tandem.ProcessManager, cfg tandem.Config) {
+	changes, err := watchFile(path)
+	if err != nil {
+		pm.Warnf("watching config: %v", err)
+		return
+	}
+	last, _ := os.ReadFile(path)
+	for range changes {
+		time.Sleep(configSettleDelay)
+		select {
+		case <-changes:
+		default:
+		}
+		// Some changes, like the file being touched or another file in its
+		// directory changing, leave the config as it was.
+		b, err := os.ReadFile(path)
+		if err != nil || bytes.Equal(b, last) {
+			continue
+		}
+		last = b
+		fileCfg, err := tandem.LoadYAMLConfig(path)
+		if err != nil {
+			pm.Warnf("reloading config: %v", err)
+			continue
+		}
+		cfg.Processes = fileCfg.Processes
+		cfg.AllowedScripts = fileCfg.AllowedScripts
+		if err := pm.Reload(cfg); err != nil {
+			pm.Warnf("reloading config: %v", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchFile sends on the returned channel whenever the file at path is
+// written or replaced, using kqueue. Its directory is watched too, since
+// editors often save by renaming a new file over it, after which the new file
+// is watched instead.
+func watchFile(path string) (<-chan struct{}, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return nil, fmt.Errorf("kqueue: %v", err)
+	}
+	watch := func(path string, fflags uint32) (int, error) {
+		fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return -1, err
+		}
+		var ev unix.Kevent_t
+		unix.SetKevent(&ev, fd, unix.EVFILT_VNODE, unix.EV_ADD|unix.EV_CLEAR)
+		ev.Fflags = fflags
+		if _, err := unix.Kevent(kq, []unix.Kevent_t{ev}, nil, nil); err != nil {
+			unix.Close(fd)
+			return -1, err
+		}
+		return fd, nil
+	}
+	const fileFlags = unix.NOTE_WRITE | unix.NOTE_EXTEND | unix.NOTE_DELETE | unix.NOTE_RENAME
+	dirFd, err := watch(filepath.Dir(path), unix.NOTE_WRITE)
+	if err != nil {
+		unix.Close(kq)
+		return nil, fmt.Errorf("watching %s: %v", filepath.Dir(path), err)
+	}
+	// The file may not exist for now, while it's being replaced.
+	fileFd, _ := watch(path, fileFlags)
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer unix.Close(kq)
+		events := make([]unix.Kevent_t, 8)
+		for {
+			n, err := unix.Kevent(kq, nil, events, nil)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			replaced := false
+			for _, ev := range events[:n] {
+				if int(ev.Ident) == dirFd || ev.Fflags&(unix.NOTE_DELETE|unix.NOTE_RENAME) != 0 {
+					replaced = true
+				}
+			}
+			if replaced {
+				if fileFd >= 0 {
+					unix.Close(fileFd)
+				}
+				fileFd, _ = watch(path, fileFlags)
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tandem.yaml")
+	if err := os.WriteFile(path, []byte("processes: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := watchFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChange := func(what string, want bool) {
+		t.Helper()
+		select {
+		case <-changes:
+			if !want {
+				t.Fatalf("%s: got a change, want none", what)
+			}
+		case <-time.After(300 * time.Millisecond):
+			if want {
+				t.Fatalf("%s: got no change, want one", what)
+			}
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("processes: [{cmd: a}]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("writing the file", true)
+
+	// Editors often save by renaming a new file over the old one.
+	tmp := filepath.Join(dir, "tandem.yaml.tmp")
+	if err := os.WriteFile(tmp, []byte("processes: [{cmd: b}]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("renaming over the file", true)
+
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("writing another file", false)
+}
@@ -6,11 +6,12 @@ require (
 	github.com/pkg/term v1.1.0
 	github.com/urfave/cli/v2 v2.23.7
 	golang.org/x/exp v0.0.0-20230111222715-75897c7a292a
+	golang.org/x/sys v0.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
-	golang.org/x/sys v0.4.0 // indirect
 )
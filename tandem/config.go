@@ -0,0 +1,141 @@
+package tandem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rosszurowski/tandem/ansi"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileNames are the names of config files searched for by
+// FindConfigFile, in order of preference.
+var ConfigFileNames = []string{"tandem.yaml", "tandem.yml"}
+
+// ProcessConfig is the configuration for a single process. Settings left
+// unset fall back to the process manager's Config.
+type ProcessConfig struct {
+	Name            string            `yaml:"name"`             // Name to label output with. Defaults to the command name.
+	Cmd             string            `yaml:"cmd"`              // Shell command to run
+	Dir             string            `yaml:"dir"`              // Directory to run the command from, relative to the root
+	Env             map[string]string `yaml:"env"`              // Extra environment variables for the command
+	Color           *int              `yaml:"color"`            // ANSI color index to label output with. Defaults to nil (picked from the palette).
+	Restart         bool              `yaml:"restart"`          // Whether to restart the command if it exits with an error
+	MaxRestarts     int               `yaml:"max_restarts"`     // Maximum number of times to restart the command
+	RestartDelay    time.Duration     `yaml:"restart_delay"`    // How long to wait before restarting the command
+	Silent          bool              `yaml:"silent"`           // Whether to silence process management messages
+	InterruptSignal string            `yaml:"interrupt_signal"` // Signal sent to ask the command to exit gracefully
+	KillSignal      string            `yaml:"kill_signal"`      // Signal sent if the command hasn't exited after its timeout
+	Groups          []string          `yaml:"groups"`           // Groups to tag the command with, for signalling them together
+	Description     string            `yaml:"description"`      // What the command is for, shown in dry runs
+	User            string            `yaml:"user"`             // Unix user to run the command as, which needs tandem to run as root
+	WatchGlobs      []string          `yaml:"watch"`            // File patterns, relative to Dir, that restart the command when matching files change
+	WaitFor         []string          `yaml:"wait_for"`         // Names of processes to wait to be ready before first starting the command
+}
+
+func (pc ProcessConfig) command() (command, error) {
+	if pc.Cmd == "" {
+		return command{}, fmt.Errorf("no command given for process %q", pc.Name)
+	}
+	name := pc.Name
+	if name == "" {
+		name = filterCmdName(pc.Cmd)
+	}
+	if name == "" {
+		name = "cmd"
+	}
+	var color int
+	if pc.Color != nil {
+		color = *pc.Color
+		if !ansi.IsValidColor(color) {
+			return command{}, fmt.Errorf("invalid color %d for process %q, expected a number from 0 to 255", color, name)
+		}
+	}
+	// Sort environment variables so the order is stable between runs.
+	var env []string
+	for k, v := range pc.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return command{
+		name:     name,
+		explicit: pc.Name != "",
+		cmd:      pc.Cmd,
+		dir:      pc.Dir,
+		env:      env,
+		restart:  pc.Restart,
+
+		color:       color,
+		customColor: pc.Color != nil,
+
+		maxRestarts:     pc.MaxRestarts,
+		restartDelay:    pc.RestartDelay,
+		silent:          pc.Silent,
+		interruptSignal: pc.InterruptSignal,
+		killSignal:      pc.KillSignal,
+		groups:          pc.Groups,
+		description:     pc.Description,
+		user:            pc.User,
+		watchGlobs:      pc.WatchGlobs,
+		waitFor:         pc.WaitFor,
+	}, nil
+}
+
+type yamlConfig struct {
+	Processes      []ProcessConfig `yaml:"processes"`
+	AllowedScripts []string        `yaml:"allowed_scripts"`
+}
+
+// LoadYAMLConfig reads a tandem.yaml config file from the given path. The
+// returned config's root is the directory containing the file.
+func LoadYAMLConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading config: %v", err)
+	}
+	var yc yamlConfig
+	if err := yaml.Unmarshal(b, &yc); err != nil {
+		return Config{}, fmt.Errorf("parsing %s: %v", filepath.Base(path), err)
+	}
+	if len(yc.Processes) == 0 && len(yc.AllowedScripts) == 0 {
+		return Config{}, fmt.Errorf("%s found but defines no processes", filepath.Base(path))
+	}
+	root, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return Config{}, fmt.Errorf("could not get absolute path for config: %v", err)
+	}
+	return Config{
+		Root:           root,
+		Processes:      yc.Processes,
+		AllowedScripts: yc.AllowedScripts,
+	}, nil
+}
+
+// FindConfigFile searches dir and its parents for a config file, returning
+// the path to the first one found. If no config file is found, it returns an
+// empty string.
+func FindConfigFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
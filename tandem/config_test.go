@@ -0,0 +1,123 @@
+package tandem
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadYAMLConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tandem.yaml")
+	err := os.WriteFile(path, []byte(`
+processes:
+  - name: api
+    cmd: go run ./cmd/api
+    dir: api
+    env:
+      PORT: "3001"
+    restart: true
+    restart_delay: 2s
+    color: 196
+    watch: ["*.go", "internal/*.go"]
+    wait_for: [black]
+  - cmd: npm run dev
+  - name: black
+    cmd: echo black
+    color: 0
+allowed_scripts:
+  - dev:js
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadYAMLConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Root != dir {
+		t.Errorf("got root %q, want %q", cfg.Root, dir)
+	}
+	if len(cfg.AllowedScripts) != 1 || cfg.AllowedScripts[0] != "dev:js" {
+		t.Errorf("got allowed scripts %v, want [dev:js]", cfg.AllowedScripts)
+	}
+	if len(cfg.Processes) != 3 {
+		t.Fatalf("got %d processes, want 3", len(cfg.Processes))
+	}
+	api := cfg.Processes[0]
+	if api.Name != "api" || api.Dir != "api" || api.Env["PORT"] != "3001" || !api.Restart ||
+		api.RestartDelay != 2*time.Second || api.Color == nil || *api.Color != 196 ||
+		!reflect.DeepEqual(api.WatchGlobs, []string{"*.go", "internal/*.go"}) || !reflect.DeepEqual(api.WaitFor, []string{"black"}) {
+		t.Errorf("got unexpected process config %+v", api)
+	}
+
+	cmd, err := cfg.Processes[1].command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.name != "npm" || cmd.customColor {
+		t.Errorf("got name %q and custom color %v, want %q and no custom color", cmd.name, cmd.customColor, "npm")
+	}
+
+	// Color 0 is a color like any other, rather than unset.
+	cmd, err = cfg.Processes[2].command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmd.customColor || cmd.color != 0 {
+		t.Errorf("got color %d (custom %v), want custom color 0", cmd.color, cmd.customColor)
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "tandem.yaml")
+	if err := os.WriteFile(want, []byte("processes: []"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FindConfigFile(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("FindConfigFile(%q) = %q, want %q", nested, got, want)
+	}
+}
+
+func TestLoadYAMLConfigEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tandem.yaml")
+	if err := os.WriteFile(path, []byte("processes: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadYAMLConfig(path)
+	if err == nil || err.Error() != "tandem.yaml found but defines no processes" {
+		t.Fatalf("LoadYAMLConfig: got error %v", err)
+	}
+}
+
+func TestNameFromDir(t *testing.T) {
+	pm, err := New(Config{
+		Root: t.TempDir(),
+		Processes: []ProcessConfig{
+			{Cmd: "npm run dev", Dir: "packages/api/"},
+			{Cmd: "npm run dev", Dir: "web", Name: "frontend"},
+			{Cmd: "go run ."},
+		},
+		NameFromDir: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"api", "frontend", "go"}
+	if got := pm.Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got names %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+package tandem
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// controlFlushTimeout is how long lines still queued for TAIL clients are
+// given to be written once tandem stops.
+const controlFlushTimeout = time.Second
+
+// controlSignals are the signals that can be sent to processes through the
+// control socket.
+var controlSignals = []namedSignal{
+	{"SIGINT", syscall.SIGINT},
+	{"SIGTERM", syscall.SIGTERM},
+	{"SIGQUIT", syscall.SIGQUIT},
+	{"SIGHUP", syscall.SIGHUP},
+	{"SIGUSR1", syscall.SIGUSR1},
+	{"SIGUSR2", syscall.SIGUSR2},
+	{"SIGKILL", syscall.SIGKILL},
+}
+
+// listenControl listens on the control socket at path. A socket left behind
+// by a process manager that didn't exit cleanly is replaced, with a warning
+// written to w, but one that's still in use isn't.
+func listenControl(path string, w io.Writer) (net.Listener, error) {
+	ln, err := net.Listen("unix", path)
+	if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+		return ln, err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another tandem", path)
+	}
+	fmt.Fprintf(w, "tandem: warning: replacing existing control socket %s\n", path)
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// serveControl handles connections to the control socket until ln is
+// closed. Connections still open once stop is closed are ended.
+func (pm *ProcessManager) serveControl(ln net.Listener, stop <-chan struct{}) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go pm.handleControl(conn, stop)
+	}
+}
+
+// handleControl runs a command read from a control socket connection. Each
+// command is a single line, and the first line of the reply is "OK" or "ERR"
+// followed by what went wrong:
+//
+//	SIGNAL group:<group> <signal>  Sends a signal to each running process in a group
+//	PAUSE <name>                   Stops a process until it's resumed
+//	RESUME <name>                  Continues a paused process
+//	STATUS                         Lists each process's name, status and restart count
+//	TAIL <name> [<lines>]          Replays a process's recent output, then streams it
+func (pm *ProcessManager) handleControl(conn net.Conn, stop <-chan struct{}) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		fmt.Fprintln(conn, "ERR expected a command")
+		return
+	}
+	switch strings.ToUpper(args[0]) {
+	case "SIGNAL":
+		reply(conn, pm.controlSignal(args[1:]))
+	case "PAUSE", "RESUME":
+		reply(conn, pm.controlPause(strings.ToUpper(args[0]), args[1:]))
+	case "STATUS":
+		if len(args) != 1 {
+			reply(conn, errors.New("expected STATUS"))
+		} else if reply(conn, nil) {
+			pm.writeStatus(conn)
+		}
+	case "TAIL":
+		proc, n, err := pm.tailArgs(args[1:])
+		if reply(conn, err) {
+			pm.streamTail(conn, r, proc, n, stop)
+		}
+	default:
+		reply(conn, fmt.Errorf("unknown command %q", args[0]))
+	}
+}
+
+// reply writes the first line of the reply to a control command, reporting
+// whether the command succeeded.
+func reply(w io.Writer, err error) bool {
+	if err != nil {
+		fmt.Fprintln(w, "ERR", err)
+		return false
+	}
+	fmt.Fprintln(w, "OK")
+	return true
+}
+
+// controlSignal runs the SIGNAL command, with the arguments given to it.
+func (pm *ProcessManager) controlSignal(args []string) error {
+	if len(args) != 2 || !strings.HasPrefix(args[0], "group:") {
+		return errors.New("expected SIGNAL group:<group> <signal>")
+	}
+	sig, err := parseSignal(args[1], controlSignals)
+	if err != nil {
+		return err
+	}
+	return pm.SignalGroup(strings.TrimPrefix(args[0], "group:"), sig)
+}
+
+// controlPause runs the PAUSE or RESUME command, with the arguments given to
+// it.
+func (pm *ProcessManager) controlPause(command string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected %s <name>", command)
+	}
+	if command == "PAUSE" {
+		return pm.Pause(args[0])
+	}
+	return pm.Resume(args[0])
+}
+
+// writeStatus writes a line for each process in reply to the STATUS command,
+// with its name, status, and the number of times it's been restarted,
+// separated by tabs.
+func (pm *ProcessManager) writeStatus(w io.Writer) {
+	for _, proc := range pm.processes() {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", proc.Name, proc.status(), proc.restartCount())
+	}
+}
+
+// tailArgs parses the arguments given to the TAIL command, returning the
+// process to tail and how many recent lines to replay.
+func (pm *ProcessManager) tailArgs(args []string) (*process, int, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, 0, errors.New("expected TAIL <name> [<lines>]")
+	}
+	proc, err := pm.process(args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	n := pm.output.tailLines
+	if len(args) == 2 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("invalid number of lines %q", args[1])
+		}
+	}
+	return proc, n, nil
+}
+
+// streamTail writes the last n lines of a process's output to conn, then each
+// line it writes from then on, until the client disconnects or stop is
+// closed. Lines are written as they are, with any ANSI codes.
+func (pm *ProcessManager) streamTail(conn net.Conn, r io.Reader, proc *process, n int, stop <-chan struct{}) {
+	a := pm.output.attach(proc, n, conn)
+	// Nothing more is read from the client, so reading only ends once it
+	// disconnects.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, r)
+		close(gone)
+	}()
+	select {
+	case <-gone:
+		pm.output.detach(proc, a)
+	case <-stop:
+		// Let the client see the last lines written before tandem exited,
+		// unless it's too slow to read them.
+		pm.output.detach(proc, a)
+		conn.SetWriteDeadline(time.Now().Add(controlFlushTimeout))
+		<-a.done
+	}
+}
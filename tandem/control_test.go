@@ -0,0 +1,212 @@
+package tandem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rosszurowski/tandem/ansi"
+)
+
+// sendControl sends a command to the control socket at path, returning the
+// first line of the reply and the connection to read the rest from.
+func sendControl(t *testing.T, path, command string) (string, *bufio.Reader, net.Conn) {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintln(conn, command)
+	r := bufio.NewReader(conn)
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(reply), r, conn
+}
+
+func TestControlSignal(t *testing.T) {
+	ansi.NoColor = true
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	trap := "trap 'echo got-usr1' USR1; echo started; while true; do sleep 0.05; done"
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: trap},
+			{Name: "web", Cmd: trap},
+		},
+		Groups:        map[string][]string{"backend": {"api"}},
+		ControlSocket: path,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		pm.run(ctx)
+		close(done)
+	}()
+	if err := pm.WaitForReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		command string
+		want    string
+	}{
+		{"SIGNAL group:backend SIGUSR1", "OK"},
+		{"SIGNAL group:nope SIGUSR1", `ERR no processes in group "nope"`},
+		{"SIGNAL group:backend SIGNOPE", "ERR invalid signal"},
+		{"SIGNAL backend SIGUSR1", "ERR expected SIGNAL group:<group> <signal>"},
+		{"PAUSE web", "OK"},
+		{"RESUME web", "OK"},
+		{"pause nope", "ERR process not found"},
+		{"RESUME", "ERR expected RESUME <name>"},
+		{"NOPE", `ERR unknown command "NOPE"`},
+	} {
+		if reply, _, _ := sendControl(t, path, tt.command); !strings.HasPrefix(reply, tt.want) {
+			t.Errorf("%s: got reply %q, want %q", tt.command, reply, tt.want)
+		}
+	}
+	<-done
+
+	out := buf.String()
+	if !strings.Contains(out, "api  got-usr1") || strings.Contains(out, "web  got-usr1") {
+		t.Fatalf("expected only api to be signalled, got %q", out)
+	}
+	if paused, resumed := strings.Index(out, "web  Paused"), strings.Index(out, "web  Resumed"); paused < 0 || resumed < paused {
+		t.Fatalf("expected web to be paused and resumed, got %q", out)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the control socket to be removed once tandem exits, got %v", err)
+	}
+}
+
+func TestControlStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "echo started; sleep 5"},
+			{Name: "job", Cmd: "echo done"},
+			{Name: "flaky", Cmd: "echo once; exit 1", MaxRestarts: 2, RestartDelay: 10 * time.Millisecond},
+		},
+		RestartOnError: true,
+		NoAutoExit:     true,
+		ControlSocket:  path,
+		Silent:         true,
+	}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runInBackground(t, ctx, pm)
+	api, _ := pm.process("api")
+	select {
+	case <-api.firstOutput:
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	if err := pm.Pause("api"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other processes may still be running, so check until they've
+	// finished.
+	want := "api\tpaused\t0\njob\texited 0\t0\nflaky\texited 1\t2\n"
+	var got string
+	for deadline := time.Now().Add(3 * time.Second); got != want && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		reply, r, _ := sendControl(t, path, "STATUS")
+		if reply != "OK" {
+			t.Fatalf("STATUS: got reply %q, want OK", reply)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = string(rest)
+	}
+	if got != want {
+		t.Fatalf("STATUS: got %q, want %q", got, want)
+	}
+	if reply, _, _ := sendControl(t, path, "STATUS api"); reply != "ERR expected STATUS" {
+		t.Fatalf("STATUS api: got reply %q, want an error", reply)
+	}
+	pm.Resume("api")
+	cancel()
+}
+
+func TestControlTail(t *testing.T) {
+	ansi.NoColor = true
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "echo one; echo two; echo three; sleep 0.3; echo live; sleep 5"},
+		},
+		ControlSocket: path,
+		Silent:        true,
+	}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runInBackground(t, ctx, pm)
+	if err := pm.WaitForReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if reply, _, _ := sendControl(t, path, "TAIL nope"); !strings.HasPrefix(reply, "ERR process not found") {
+		t.Fatalf("TAIL nope: got reply %q, want an error", reply)
+	}
+	if reply, _, _ := sendControl(t, path, "TAIL api x"); !strings.HasPrefix(reply, "ERR invalid number of lines") {
+		t.Fatalf("TAIL api x: got reply %q, want an error", reply)
+	}
+
+	reply, r, conn := sendControl(t, path, "TAIL api 2")
+	if reply != "OK" {
+		t.Fatalf("TAIL api 2: got reply %q, want OK", reply)
+	}
+	var lines []string
+	for len(lines) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading tailed lines: %v, after %q", err, lines)
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	if want := []string{"two", "three", "live"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("got tailed lines %q, want %q", lines, want)
+	}
+
+	// Disconnecting detaches the client from the process's output.
+	conn.Close()
+	proc, _ := pm.process("api")
+	deadline := time.Now().Add(time.Second)
+	for {
+		pm.output.mutex.Lock()
+		n := len(pm.output.attached[proc])
+		pm.output.mutex.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client to be detached once it disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+}
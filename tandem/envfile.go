@@ -0,0 +1,61 @@
+package tandem
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseCmdEnvFile parses an optional "env-file(path):" prefix from a command,
+// which loads environment variables for the command from a dotenv file. It
+// returns the path, if one was given, and the command with the prefix removed.
+func parseCmdEnvFile(cmd string) (string, string, error) {
+	s := strings.TrimSpace(cmd)
+	if !strings.HasPrefix(s, "env-file(") {
+		return "", cmd, nil
+	}
+	path, rest, ok := strings.Cut(strings.TrimPrefix(s, "env-file("), "):")
+	if !ok || path == "" {
+		return "", "", fmt.Errorf("invalid env-file prefix in %q, expected env-file(<path>):<command>", cmd)
+	}
+	return path, strings.TrimSpace(rest), nil
+}
+
+// loadEnvFile reads "KEY=value" lines from the dotenv file at path, relative
+// to root, in order. Blank lines and lines starting with '#' are skipped, an
+// "export " prefix is allowed, and values may be wrapped in quotes.
+func loadEnvFile(root, path string) ([]string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, configErrorf(ErrKindBadEnvFile, "reading env file: %v", err)
+	}
+	defer f.Close()
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, configErrorf(ErrKindBadEnvFile, "parsing %s: line %d: expected KEY=value, got %q", filepath.Base(path), n, line)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		env = append(env, key+"="+val)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, configErrorf(ErrKindBadEnvFile, "reading env file: %v", err)
+	}
+	return env, nil
+}
@@ -0,0 +1,88 @@
+package tandem
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rosszurowski/tandem/ansi"
+	"golang.org/x/exp/slices"
+)
+
+func TestParseCmdEnvFile(t *testing.T) {
+	tests := []struct {
+		input   string
+		path    string
+		cmd     string
+		wantErr bool
+	}{
+		{"node server.js", "", "node server.js", false},
+		{"env-file(.env.production):node server.js", ".env.production", "node server.js", false},
+		{"env-file(.env): node server.js", ".env", "node server.js", false},
+		{"env-file():node server.js", "", "", true},
+		{"env-file(.env)node server.js", "", "", true},
+	}
+
+	for _, tt := range tests {
+		path, cmd, err := parseCmdEnvFile(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseCmdEnvFile(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+		}
+		if path != tt.path || cmd != tt.cmd {
+			t.Errorf("parseCmdEnvFile(%q) = %q, %q, want %q, %q", tt.input, path, cmd, tt.path, tt.cmd)
+		}
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".env"), `
+# Database settings
+DATABASE_URL=postgres://localhost/app
+export API_KEY="secret value"
+GREETING='hi'
+EMPTY=
+`)
+	env, err := loadEnvFile(dir, ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DATABASE_URL=postgres://localhost/app", "API_KEY=secret value", "GREETING=hi", "EMPTY="}
+	if !slices.Equal(env, want) {
+		t.Fatalf("loadEnvFile: got %q, want %q", env, want)
+	}
+
+	writeFile(t, filepath.Join(dir, ".env.bad"), "NOT A VARIABLE\n")
+	var cfgErr *ConfigError
+	if _, err := loadEnvFile(dir, ".env.bad"); !errors.As(err, &cfgErr) || cfgErr.Kind != ErrKindBadEnvFile {
+		t.Fatalf("expected a bad env file error, got %v", err)
+	}
+	if _, err := loadEnvFile(dir, ".env.missing"); !errors.As(err, &cfgErr) || cfgErr.Kind != ErrKindBadEnvFile {
+		t.Fatalf("expected a bad env file error, got %v", err)
+	}
+}
+
+func TestEnvFilePrefix(t *testing.T) {
+	ansi.NoColor = true
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".env.production"), "MODE=production\n")
+	pm := MustNew(Config{
+		Root: dir,
+		Cmds: []string{
+			"env-file(.env.production):echo api=$MODE && sleep 0.1",
+			"echo web=$MODE && sleep 0.1",
+		},
+		Silent: true,
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "api=production") {
+		t.Fatalf("expected env file to be loaded, got %q", out)
+	}
+	if strings.Contains(out, "web=production") {
+		t.Fatalf("expected env file to only apply to its process, got %q", out)
+	}
+}
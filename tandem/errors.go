@@ -0,0 +1,51 @@
+package tandem
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrProcessNotFound is returned when looking up a process by a name that
+// doesn't match any process.
+var ErrProcessNotFound = errors.New("process not found")
+
+// ConfigErrorKind describes what's wrong with a configuration.
+type ConfigErrorKind int
+
+const (
+	// ErrKindInvalidOption is an invalid value for a configuration option,
+	// like an unknown signal name or a malformed command.
+	ErrKindInvalidOption ConfigErrorKind = iota
+	// ErrKindMissingScript is an npm script that isn't in package.json.
+	ErrKindMissingScript
+	// ErrKindBadPackageJSON is a package.json that couldn't be found, read,
+	// or parsed.
+	ErrKindBadPackageJSON
+	// ErrKindBadDirectory is a directory that couldn't be resolved or
+	// created.
+	ErrKindBadDirectory
+	// ErrKindUnknownProcess is an option given for a process name that
+	// doesn't match any process.
+	ErrKindUnknownProcess
+	// ErrKindBadProcfile is a Procfile that couldn't be read or parsed.
+	ErrKindBadProcfile
+	// ErrKindBadEnvFile is an env file that couldn't be read or parsed.
+	ErrKindBadEnvFile
+	// ErrKindBadIgnoreFile is an ignore file that couldn't be read.
+	ErrKindBadIgnoreFile
+)
+
+// ConfigError is returned by New when a configuration is invalid. Use
+// errors.As to check its Kind.
+type ConfigError struct {
+	Kind   ConfigErrorKind
+	Detail string // Human-readable description of the error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Detail
+}
+
+func configErrorf(kind ConfigErrorKind, format string, a ...interface{}) error {
+	return &ConfigError{Kind: kind, Detail: fmt.Sprintf(format, a...)}
+}
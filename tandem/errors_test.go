@@ -0,0 +1,45 @@
+package tandem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigError(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "package.json"), []byte(`{"scripts": {"dev": "echo"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bad := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bad, "package.json"), []byte(`{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cfg  Config
+		want ConfigErrorKind
+	}{
+		{Config{Root: root, Cmds: []string{"npm:missing"}}, ErrKindMissingScript},
+		{Config{Root: root, Cmds: []string{"npm:missing:*"}}, ErrKindMissingScript},
+		{Config{Root: bad, Cmds: []string{"npm:dev"}, NoPackageJSONWalk: true}, ErrKindBadPackageJSON},
+		{Config{Root: t.TempDir(), Cmds: []string{"npm:dev"}, NoPackageJSONWalk: true}, ErrKindBadPackageJSON},
+		{Config{Root: root, Cmds: []string{"echo"}, Timeouts: map[string]int{"nope": 1}}, ErrKindUnknownProcess},
+		{Config{Root: root, Cmds: []string{"echo"}, KillSignal: "SIGNOPE"}, ErrKindInvalidOption},
+		{Config{Root: root, Cmds: []string{"echo"}, LogDir: filepath.Join(root, "package.json")}, ErrKindBadDirectory},
+		{Config{Root: filepath.Join(root, "missing"), Cmds: []string{"echo"}}, ErrKindBadDirectory},
+		{Config{Root: filepath.Join(root, "package.json"), Cmds: []string{"echo"}}, ErrKindBadDirectory},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.cfg)
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("New(%+v): got error %v, want a ConfigError", tt.cfg, err)
+			continue
+		}
+		if configErr.Kind != tt.want {
+			t.Errorf("New(%+v): got kind %v, want %v (%v)", tt.cfg, configErr.Kind, tt.want, err)
+		}
+	}
+}
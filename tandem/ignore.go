@@ -0,0 +1,59 @@
+package tandem
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the file in the root that IgnoreFile defaults to.
+const ignoreFileName = ".tandemignore"
+
+// loadIgnoreFile reads patterns of npm script names to leave out of wildcard
+// expansion from the file at path, relative to root, one per line. Blank
+// lines and lines starting with '#' are skipped. If path is empty, the
+// .tandemignore file in root is read if there is one.
+func loadIgnoreFile(root, path string) ([]string, error) {
+	optional := path == ""
+	if optional {
+		path = ignoreFileName
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	f, err := os.Open(path)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, configErrorf(ErrKindBadIgnoreFile, "reading ignore file: %v", err)
+	}
+	defer f.Close()
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, configErrorf(ErrKindBadIgnoreFile, "reading ignore file: %v", err)
+	}
+	return patterns, nil
+}
+
+// isIgnoredScript returns whether the npm script name matches any of the
+// ignore patterns, which use the same wildcards as 'npm:dev:*'.
+func isIgnoredScript(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if wildcardMatch(p, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package tandem
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestLoadIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	patterns, err := loadIgnoreFile(dir, "")
+	if err != nil || patterns != nil {
+		t.Fatalf("loadIgnoreFile without a .tandemignore: got %q, %v, want nothing", patterns, err)
+	}
+
+	writeFile(t, filepath.Join(dir, ".tandemignore"), `
+# Slow scripts
+dev:storybook
+
+*:legacy
+`)
+	patterns, err = loadIgnoreFile(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dev:storybook", "*:legacy"}; !slices.Equal(patterns, want) {
+		t.Fatalf("loadIgnoreFile: got %q, want %q", patterns, want)
+	}
+
+	var cfgErr *ConfigError
+	if _, err := loadIgnoreFile(dir, "missing"); !errors.As(err, &cfgErr) || cfgErr.Kind != ErrKindBadIgnoreFile {
+		t.Fatalf("expected a bad ignore file error, got %v", err)
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "package.json"), `{"scripts": {"dev:js": "vite", "dev:css": "postcss -w", "dev:storybook": "storybook"}}`)
+	writeFile(t, filepath.Join(root, ".tandemignore"), "dev:storybook\n")
+
+	pm, err := New(Config{Root: root, Cmds: []string{"npm:dev:*"}, SortByName: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pm.Names(), []string{"dev:css", "dev:js"}; !slices.Equal(got, want) {
+		t.Fatalf("Names() = %v, want %v", got, want)
+	}
+
+	// Ignored scripts can still be run by name.
+	pm, err = New(Config{Root: root, Cmds: []string{"npm:dev:storybook"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pm.Names(), []string{"dev:storybook"}; !slices.Equal(got, want) {
+		t.Fatalf("Names() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package tandem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// lockFileName is where the lock file is written in the root, unless another
+// path is given.
+const lockFileName = ".tandem.lock"
+
+// lockFile describes a running process manager, so other tools can tell
+// that it's running and what it's running.
+type lockFile struct {
+	PID       int       `json:"pid"`
+	Processes []string  `json:"processes"`
+	Started   time.Time `json:"started"`
+}
+
+// writeLockFile writes a lock file for the current process to path. An
+// existing lock file is overwritten, with a warning written to w, since it's
+// most likely left over from a process manager that didn't exit cleanly.
+func writeLockFile(path string, names []string, w io.Writer) error {
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(w, "tandem: warning: overwriting existing lock file %s\n", path)
+	}
+	b, err := json.Marshal(lockFile{
+		PID:       os.Getpid(),
+		Processes: names,
+		Started:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// removeLockFile removes the lock file at path, as long as it still belongs
+// to the current process.
+func removeLockFile(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var lock lockFile
+	if err := json.Unmarshal(b, &lock); err != nil || lock.PID != os.Getpid() {
+		return nil
+	}
+	return os.Remove(path)
+}
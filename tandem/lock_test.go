@@ -0,0 +1,107 @@
+package tandem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tandem.lock")
+	pm := MustNew(Config{
+		Processes:    []ProcessConfig{{Name: "api", Cmd: "sleep 0.3"}, {Name: "web", Cmd: "sleep 0.3"}},
+		LockFilePath: path,
+		Silent:       true,
+	})
+
+	var lock lockFile
+	read := make(chan error, 1)
+	_, err := captureStdout(func() {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			b, err := os.ReadFile(path)
+			if err == nil {
+				err = json.Unmarshal(b, &lock)
+			}
+			read <- err
+		}()
+		pm.Run()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+	if lock.PID != os.Getpid() || !slices.Equal(lock.Processes, []string{"api", "web"}) || lock.Started.IsZero() {
+		t.Fatalf("unexpected lock file contents %+v", lock)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected lock file to be removed, got %v", err)
+	}
+}
+
+func TestLockFileDefault(t *testing.T) {
+	root := t.TempDir()
+	// exists reports whether the default lock file exists while a process
+	// manager runs with cfg.
+	exists := func(cfg Config) bool {
+		t.Helper()
+		cfg.Root, cfg.Cmds, cfg.Silent = root, []string{"sleep 0.2"}, true
+		pm, err := NewWithWriter(cfg, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(chan bool, 1)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_, err := os.Stat(filepath.Join(root, ".tandem.lock"))
+			found <- err == nil
+		}()
+		pm.run(context.Background())
+		return <-found
+	}
+	if !exists(Config{}) {
+		t.Fatal("expected a lock file in the root by default")
+	}
+	if exists(Config{NoLockFile: true}) {
+		t.Fatal("expected no lock file with NoLockFile")
+	}
+
+	// A lock file left behind is overwritten, with a warning in the output.
+	path := filepath.Join(root, "tandem.lock")
+	if err := os.WriteFile(path, []byte(`{"pid": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{Root: root, Cmds: []string{"true"}, Silent: true, LockFilePath: "tandem.lock"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.run(context.Background())
+	if !strings.Contains(buf.String(), "overwriting existing lock file "+path) {
+		t.Fatalf("expected a warning about the existing lock file, got %q", buf.String())
+	}
+}
+
+func TestRemoveLockFileOtherProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tandem.lock")
+	if err := os.WriteFile(path, []byte(`{"pid": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeLockFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected lock file of another process to be kept, got %v", err)
+	}
+}
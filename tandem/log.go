@@ -0,0 +1,122 @@
+package tandem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rosszurowski/tandem/ansi"
+)
+
+// fileLogger writes the output of each process to its own file in a
+// directory, without any ANSI escape sequences. Nothing is written until it's
+// opened, or after it's closed.
+type fileLogger struct {
+	dir    string
+	format string // "text" or "json"
+
+	mu     sync.Mutex
+	active bool // Whether the logger is open for writes
+	files  map[*process]*os.File
+	failed map[*process]bool // Processes whose file couldn't be opened
+}
+
+// newFileLogger creates a logger that writes to files in dir. The directory
+// isn't created until the logger is opened. The format is "text" (the
+// default) or "json", in any case.
+func newFileLogger(dir, format string) (*fileLogger, error) {
+	format = strings.ToLower(format)
+	switch format {
+	case "":
+		format = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return nil, configErrorf(ErrKindBadDirectory, "log directory %s isn't a directory", dir)
+	}
+	return &fileLogger{
+		dir:    dir,
+		format: format,
+		files:  make(map[*process]*os.File),
+		failed: make(map[*process]bool),
+	}, nil
+}
+
+// logLine is a line of output as written in JSON logs.
+type logLine struct {
+	Time time.Time `json:"time"`
+	Name string    `json:"name"`
+	Line string    `json:"line"`
+}
+
+// Open creates the log directory if needed, and starts accepting writes.
+func (l *fileLogger) Open() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return fmt.Errorf("couldn't create log directory: %v", err)
+	}
+	l.active = true
+	l.failed = make(map[*process]bool)
+	return nil
+}
+
+// Write appends a line of output from a process to its log file, opening the
+// file the first time the process writes to it. Lines written while the
+// logger isn't open are dropped. If the file can't be opened, the error is
+// returned once, and later lines from the process are dropped.
+func (l *fileLogger) Write(proc *process, p []byte) error {
+	line := logLine{Time: time.Now(), Name: proc.Name, Line: ansi.Strip(string(p))}
+
+	var buf bytes.Buffer
+	if l.format == "json" {
+		json.NewEncoder(&buf).Encode(line)
+	} else {
+		fmt.Fprintf(&buf, "[%s] [%s] %s\n", line.Time.Format(time.RFC3339), line.Name, line.Line)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.active || l.failed[proc] {
+		return nil
+	}
+	f, err := l.open(proc)
+	if err != nil {
+		// Only report the first failure, rather than every line.
+		l.failed[proc] = true
+		return err
+	}
+	buf.WriteTo(f)
+	return nil
+}
+
+func (l *fileLogger) open(proc *process) (*os.File, error) {
+	if f := l.files[proc]; f != nil {
+		return f, nil
+	}
+	name := strings.ReplaceAll(proc.Name, string(filepath.Separator), "_") + ".log"
+	f, err := os.OpenFile(filepath.Join(l.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l.files[proc] = f
+	return f, nil
+}
+
+// Close closes all open log files, and drops any further writes.
+func (l *fileLogger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active = false
+	for proc, f := range l.files {
+		f.Close()
+		delete(l.files, proc)
+	}
+}
@@ -0,0 +1,83 @@
+package tandem
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLogDir(t *testing.T) {
+	dir := t.TempDir()
+	pm := MustNew(Config{
+		Cmds:   []string{`printf '\033[0;31mred\033[0m\n' && sleep 0.1`},
+		Silent: true,
+		LogDir: dir,
+	})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "printf.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\[\S+\] \[printf\] red\n$`).Match(b) {
+		t.Fatalf("unexpected log contents %q", b)
+	}
+
+	// Lines written after the processes finish aren't logged, and don't
+	// reopen the file.
+	captureStdout(func() {
+		pm.processes()[0].writeLine([]byte("late"))
+	})
+	if b2, _ := os.ReadFile(filepath.Join(dir, "printf.log")); string(b2) != string(b) {
+		t.Fatalf("expected no writes after close, got %q", b2)
+	}
+	if n := len(pm.output.logger.files); n != 0 {
+		t.Fatalf("expected no open log files after close, got %d", n)
+	}
+}
+
+func TestLogDirDryRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	pm := MustNew(Config{Cmds: []string{"echo hello"}, LogDir: dir})
+	if _, err := captureStdout(pm.DryRun); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected a dry run not to create the log directory, got %v", err)
+	}
+}
+
+func TestLogDirJSON(t *testing.T) {
+	dir := t.TempDir()
+	pm := MustNew(Config{
+		Cmds:      []string{"echo hello && sleep 0.1"},
+		Silent:    true,
+		LogDir:    dir,
+		LogFormat: "JSON",
+	})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "echo.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line logLine
+	if err := json.Unmarshal(b, &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Name != "echo" || line.Line != "hello" || line.Time.IsZero() {
+		t.Fatalf("unexpected log line %+v", line)
+	}
+
+	_, err = New(Config{Cmds: []string{"echo"}, LogDir: dir, LogFormat: "xml"})
+	if err == nil || !strings.Contains(err.Error(), "invalid log format") {
+		t.Fatalf("New: expected invalid log format error, got %v", err)
+	}
+}
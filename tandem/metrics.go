@@ -0,0 +1,145 @@
+package tandem
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultMetricsInterval is how often process resource usage is sampled
+	// for metrics, if MetricsInterval isn't set.
+	defaultMetricsInterval = 5 * time.Second
+	// clockTicks is the number of clock ticks per second that CPU times in
+	// /proc are measured in. It's USER_HZ, which is 100 on every mainstream
+	// Linux architecture, whatever the kernel's own tick rate.
+	clockTicks = 100
+)
+
+// usage is the resource usage of a process, including anything else in its
+// process group.
+type usage struct {
+	rssBytes   int64
+	cpuSeconds float64
+}
+
+// sampleUsage records the resource usage of each process. Running processes
+// are read from /proc. Processes that have exited keep the CPU time they used
+// and report no memory, since they no longer hold any.
+func (pm *ProcessManager) sampleUsage() {
+	var groups map[int]usage
+	for _, proc := range pm.processes() {
+		var u usage
+		pid, state := proc.proc()
+		if pid != 0 && state == nil {
+			if groups == nil {
+				groups = readGroupUsage()
+			}
+			u = groups[pid]
+		} else if state != nil {
+			if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+				u.cpuSeconds = time.Duration(syscall.TimevalToNsec(ru.Utime) + syscall.TimevalToNsec(ru.Stime)).Seconds()
+			}
+		} else {
+			continue
+		}
+		proc.mu.Lock()
+		proc.usage = u
+		proc.mu.Unlock()
+	}
+}
+
+// readGroupUsage reads the resource usage of every process from /proc, summed
+// by process group. Each process runs in its own session, so its group ID is
+// its PID.
+func readGroupUsage() map[int]usage {
+	groups := make(map[int]usage)
+	pageSize, ticksPerSecond := int64(os.Getpagesize()), float64(clockTicks)
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// The command name is in parentheses and may contain spaces, so
+		// fields are counted from after it.
+		i := bytes.LastIndexByte(b, ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(b[i+1:]))
+		if len(fields) < 22 {
+			continue
+		}
+		// Fields start at the state (3rd field in proc(5)), so the process
+		// group is fields[2], CPU times are fields[11:15], and RSS is
+		// fields[21].
+		pgrp, _ := strconv.Atoi(fields[2])
+		var ticks int64
+		for _, f := range fields[11:15] {
+			n, _ := strconv.ParseInt(f, 10, 64)
+			ticks += n
+		}
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		u := groups[pgrp]
+		u.rssBytes += rss * pageSize
+		u.cpuSeconds += float64(ticks) / ticksPerSecond
+		groups[pgrp] = u
+	}
+	return groups
+}
+
+// sampleMetrics samples resource usage every interval until stop is closed.
+func (pm *ProcessManager) sampleMetrics(interval time.Duration, stop <-chan struct{}) {
+	pm.sampleUsage()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			pm.sampleUsage()
+		}
+	}
+}
+
+// serveMetrics serves the resource usage of each process at /metrics on the
+// listener, in the Prometheus text format, until it's closed.
+func (pm *ProcessManager) serveMetrics(ln net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		pm.writeMetrics(w)
+	})
+	http.Serve(ln, mux)
+}
+
+// writeMetrics writes the last sampled resource usage of each process in the
+// Prometheus text format.
+func (pm *ProcessManager) writeMetrics(w http.ResponseWriter) {
+	procs := pm.processes()
+	usages := make([]usage, len(procs))
+	for i, proc := range procs {
+		proc.mu.Lock()
+		usages[i] = proc.usage
+		proc.mu.Unlock()
+	}
+	fmt.Fprintln(w, "# HELP tandem_process_rss_bytes Resident memory of the process and its children, in bytes.")
+	fmt.Fprintln(w, "# TYPE tandem_process_rss_bytes gauge")
+	for i, proc := range procs {
+		fmt.Fprintf(w, "tandem_process_rss_bytes{name=%s} %d\n", strconv.Quote(proc.Name), usages[i].rssBytes)
+	}
+	fmt.Fprintln(w, "# HELP tandem_process_cpu_seconds_total CPU time used by the process and its children, in seconds.")
+	fmt.Fprintln(w, "# TYPE tandem_process_cpu_seconds_total gauge")
+	for i, proc := range procs {
+		fmt.Fprintf(w, "tandem_process_cpu_seconds_total{name=%s} %g\n", strconv.Quote(proc.Name), usages[i].cpuSeconds)
+	}
+}
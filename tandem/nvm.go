@@ -0,0 +1,94 @@
+package tandem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// nvmVersionFiles are the files read to find the node version for a project,
+// in order of preference.
+var nvmVersionFiles = []string{".nvmrc", ".node-version"}
+
+// findNvmBin returns the bin directory of the nvm-installed node version
+// requested by the .nvmrc or .node-version file in root. It returns an empty
+// string if there's no version file.
+func findNvmBin(root string) (string, error) {
+	var version, file string
+	for _, name := range nvmVersionFiles {
+		b, err := os.ReadFile(filepath.Join(root, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("reading %s: %v", name, err)
+		}
+		version, file = strings.TrimSpace(string(b)), name
+		break
+	}
+	if file == "" {
+		return "", nil
+	}
+	if version == "" {
+		return "", fmt.Errorf("no node version given in %s", file)
+	}
+
+	nvmDir := os.Getenv("NVM_DIR")
+	if nvmDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("finding nvm directory: %v", err)
+		}
+		nvmDir = filepath.Join(home, ".nvm")
+	}
+	versionsDir := filepath.Join(nvmDir, "versions", "node")
+	entries, err := os.ReadDir(versionsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("reading nvm versions: %v", err)
+	}
+	var installed []string
+	for _, e := range entries {
+		if e.IsDir() {
+			installed = append(installed, e.Name())
+		}
+	}
+	match := matchNodeVersion(version, installed)
+	if match == "" {
+		return "", fmt.Errorf("node %s from %s isn't installed with nvm", version, file)
+	}
+	return filepath.Join(versionsDir, match, "bin"), nil
+}
+
+// matchNodeVersion returns the newest of the installed versions (like
+// "v18.17.0") matching the requested version, which may be partial (like
+// "18" or "v18.17"). It returns an empty string if none match.
+func matchNodeVersion(version string, installed []string) string {
+	want := strings.TrimPrefix(version, "v")
+	var best string
+	for _, v := range installed {
+		have := strings.TrimPrefix(v, "v")
+		if have != want && !strings.HasPrefix(have, want+".") {
+			continue
+		}
+		if best == "" || compareVersions(have, strings.TrimPrefix(best, "v")) > 0 {
+			best = v
+		}
+	}
+	return best
+}
+
+// compareVersions compares two dotted version numbers, returning a negative
+// number if a < b, zero if they're equal, and a positive number if a > b.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		if an != bn {
+			return an - bn
+		}
+	}
+	return len(as) - len(bs)
+}
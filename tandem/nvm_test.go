@@ -0,0 +1,23 @@
+package tandem
+
+import "testing"
+
+func TestMatchNodeVersion(t *testing.T) {
+	installed := []string{"v16.20.0", "v18.9.1", "v18.17.0", "v20.5.1"}
+	tests := []struct {
+		version, want string
+	}{
+		{"18", "v18.17.0"},
+		{"v18.9", "v18.9.1"},
+		{"20.5.1", "v20.5.1"},
+		{"v1", ""},
+		{"lts/*", ""},
+	}
+
+	for _, tt := range tests {
+		got := matchNodeVersion(tt.version, installed)
+		if got != tt.want {
+			t.Errorf("matchNodeVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
@@ -6,99 +6,738 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pkg/term/termios"
 	"github.com/rosszurowski/tandem/ansi"
 )
 
 type ptyPipe struct {
+	mu       sync.Mutex // Guards pty, so input can be written from other goroutines
 	pty, tty *os.File
+	// stderr is the read end of a separate pipe for stderr, if stderr isn't
+	// interleaved with stdout through the tty.
+	stderr, stderrW *os.File
+	// limiter limits how fast lines of output are written, if set.
+	limiter *rateLimiter
+	// readers waits for the goroutines reading output from pty and stderr,
+	// so no output is written once the pipe is closed.
+	readers sync.WaitGroup
+}
+
+// rateLimiter is a token bucket that limits how many lines per second a
+// process can write, counting the lines it drops.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Lines per second, which is also the most that can burst
+	tokens  float64
+	last    time.Time
+	dropped int
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// allow reports whether a line can be written now. If it can, it also
+// returns how many lines were dropped since the last one was allowed.
+func (r *rateLimiter) allow() (ok bool, dropped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+	if r.tokens < 1 {
+		r.dropped++
+		return false, 0
+	}
+	r.tokens--
+	dropped, r.dropped = r.dropped, 0
+	return true, dropped
+}
+
+// takeDropped returns how many lines were dropped since the last one was
+// allowed, and resets the count.
+func (r *rateLimiter) takeDropped() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dropped := r.dropped
+	r.dropped = 0
+	return dropped
+}
+
+// outputStats counts the output a process has produced.
+type outputStats struct {
+	lines, bytes int64
 }
 
 type multiOutput struct {
-	maxNameLength int
+	maxNameLength int // Guarded by mutex once output has started
 	mutex         sync.Mutex
+	wroteLines    bool // Whether any lines have been written, guarded by mutex
 	pipes         map[*process]*ptyPipe
+	stats         map[*process]*outputStats // Guarded by mutex
 	printProcName bool
+	maxLineLength int
+	filters       []*regexp.Regexp
+	excludes      []*regexp.Regexp
+	separateErr   bool
+	prefixStyle   string
+	prefixSep     string      // Written after the prefix, if set, instead of the style's default
+	outputWidth   int         // Column to wrap lines at, including the prefix, if set
+	maxRate       int         // Most lines per second each process can write, if set
+	logger        *fileLogger // Writes output to files too, if set
+	stderrColor   *int        // Color for errors and stderr lines if not red, or -1 for the process's color
+	tailLines     int         // Lines of output kept per process for Attach
+	out           io.Writer   // Where output is written, or os.Stdout if nil
+
+	tails    map[*process]*lineRing                // Guarded by mutex
+	attached map[*process]map[*attachment]struct{} // Guarded by mutex
+
+	// Output is buffered for orderWindow, if set, then written sorted by
+	// process name. Guarded by mutex.
+	orderWindow time.Duration
+	pending     []pendingLine
+	flushTimer  *time.Timer
 }
 
 func (m *multiOutput) openPipe(proc *process) (pipe *ptyPipe) {
 	var err error
 
-	pipe = m.pipes[proc]
+	pipe = m.pipe(proc)
 
+	pipe.mu.Lock()
 	pipe.pty, pipe.tty, err = termios.Pty()
+	pipe.mu.Unlock()
 	fatalOnErr(err)
 
 	proc.Stdout = pipe.tty
 	proc.Stderr = pipe.tty
 	proc.Stdin = pipe.tty
-	proc.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
+
+	if m.separateErr {
+		pipe.stderr, pipe.stderrW, err = os.Pipe()
+		fatalOnErr(err)
+		proc.Stderr = pipe.stderrW
+	}
+	proc.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true, Credential: proc.credential}
 
 	return
 }
 
 func (m *multiOutput) Connect(proc *process) {
+	m.mutex.Lock()
 	if len(proc.Name) > m.maxNameLength {
+		// Lines already written can't be realigned, so mark where the
+		// alignment changes.
+		if m.wroteLines && m.printProcName {
+			io.WriteString(m.writer(), ansi.Dim("--- name column expanded ---")+"\n")
+		}
 		m.maxNameLength = len(proc.Name)
 	}
+	defer m.mutex.Unlock()
 
 	if m.pipes == nil {
 		m.pipes = make(map[*process]*ptyPipe)
 	}
 
 	m.pipes[proc] = &ptyPipe{}
+	if m.maxRate > 0 {
+		m.pipes[proc].limiter = newRateLimiter(m.maxRate)
+	}
+
+	if m.stats == nil {
+		m.stats = make(map[*process]*outputStats)
+	}
+	m.stats[proc] = &outputStats{}
+
+	if m.tailLines > 0 {
+		if m.tails == nil {
+			m.tails = make(map[*process]*lineRing)
+		}
+		m.tails[proc] = newLineRing(m.tailLines)
+	}
+}
+
+// pipe returns the pipe for a process. Processes can be connected while
+// others are running, so the map is only read with the mutex held.
+func (m *multiOutput) pipe(proc *process) *ptyPipe {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.pipes[proc]
 }
 
 func (m *multiOutput) PipeOutput(proc *process) {
 	pipe := m.openPipe(proc)
 
-	go func(proc *process, pipe *ptyPipe) {
-		scanLines(pipe.pty, func(b []byte) bool {
-			m.WriteLine(proc, b)
+	pipe.readers.Add(1)
+	go func(proc *process, pty *os.File) {
+		defer pipe.readers.Done()
+		scanLines(pty, func(b []byte) bool {
+			m.writeOutput(proc, b)
 			return true
 		})
-	}(proc, pipe)
+	}(proc, pipe.pty)
+
+	if pipe.stderr != nil {
+		pipe.readers.Add(1)
+		go func(proc *process, stderr *os.File) {
+			defer pipe.readers.Done()
+			scanLines(stderr, func(b []byte) bool {
+				m.countOutput(proc, b)
+				if m.allowLine(proc) {
+					m.writeLine(proc, []byte(m.colorErr(proc, string(bytes.TrimPrefix(b, []byte("/bin/sh: "))))), true)
+				}
+				proc.checkReady(b)
+				return true
+			})
+		}(proc, pipe.stderr)
+	}
 }
 
+// pipeDrainTimeout is how long output left in a process's terminal once it
+// exits is given to be read. Anything it started in the background can keep
+// the terminal open, so the wait is cut short rather than waiting for them.
+const pipeDrainTimeout = 100 * time.Millisecond
+
 func (m *multiOutput) ClosePipe(proc *process) {
-	if pipe := m.pipes[proc]; pipe != nil {
-		pipe.pty.Close()
+	if pipe := m.pipe(proc); pipe != nil {
+		// Closing our end of the terminal first lets the readers see the end
+		// of the output once the process has exited, rather than losing
+		// whatever it wrote just before exiting.
 		pipe.tty.Close()
+		if pipe.stderrW != nil {
+			pipe.stderrW.Close()
+		}
+		drained := make(chan struct{})
+		go func() {
+			pipe.readers.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-time.After(pipeDrainTimeout):
+		}
+
+		pipe.mu.Lock()
+		pipe.pty.Close()
+		pipe.pty = nil
+		pipe.mu.Unlock()
+		if pipe.stderr != nil {
+			pipe.stderr.Close()
+			pipe.stderr, pipe.stderrW = nil, nil
+		}
+		<-drained
 	}
+	m.writeDropped(proc)
 }
 
-func (m *multiOutput) WriteLine(proc *process, p []byte) {
-	var buf bytes.Buffer
+// writeOutput writes a line of output from a process, counting it in the
+// process's stats and checking whether it marks the process as ready.
+func (m *multiOutput) writeOutput(proc *process, p []byte) {
+	m.countOutput(proc, p)
+	if m.allowLine(proc) {
+		m.writeLine(proc, p, true)
+	}
+	proc.checkReady(p)
+}
 
-	if m.printProcName {
-		buf.WriteString(ansi.ColorStart(proc.Color))
-		if m.printProcName {
-			buf.WriteString(proc.Name)
-			for i := len(proc.Name); i <= m.maxNameLength; i++ {
-				buf.WriteByte(' ')
-			}
+// allowLine reports whether a line of output from a process can be written
+// without going over the rate limit. Once lines are allowed again after
+// some have been dropped, it writes how many were dropped.
+func (m *multiOutput) allowLine(proc *process) bool {
+	pipe := m.pipe(proc)
+	if pipe == nil || pipe.limiter == nil {
+		return true
+	}
+	ok, dropped := pipe.limiter.allow()
+	m.writeDroppedCount(proc, dropped)
+	return ok
+}
+
+// writeDropped writes how many lines of output from a process were dropped
+// by the rate limit since the last one was written, if any.
+func (m *multiOutput) writeDropped(proc *process) {
+	if pipe := m.pipe(proc); pipe != nil && pipe.limiter != nil {
+		m.writeDroppedCount(proc, pipe.limiter.takeDropped())
+	}
+}
+
+func (m *multiOutput) writeDroppedCount(proc *process, dropped int) {
+	if dropped == 0 {
+		return
+	}
+	noun := "lines"
+	if dropped == 1 {
+		noun = "line"
+	}
+	m.WriteLine(proc, []byte(ansi.Dim(fmt.Sprintf("[%d %s dropped]", dropped, noun))))
+}
+
+// countOutput counts a line of output read from a process, as opposed to
+// lines written by tandem about it, like "Starting...".
+func (m *multiOutput) countOutput(proc *process, p []byte) {
+	proc.markOutput()
+	proc.touch()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if stats := m.stats[proc]; stats != nil {
+		stats.lines++
+		stats.bytes += int64(len(p))
+	}
+}
+
+// Stats returns the number of lines and bytes of output a process has
+// produced.
+func (m *multiOutput) Stats(proc *process) (lines, bytes int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if stats := m.stats[proc]; stats != nil {
+		return stats.lines, stats.bytes
+	}
+	return 0, 0
+}
+
+// lineRing keeps the most recent lines added to it, up to its size.
+type lineRing struct {
+	lines [][]byte
+	next  int  // Index the next line is added at
+	full  bool // Whether lines has wrapped around
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{lines: make([][]byte, size)}
+}
+
+func (r *lineRing) add(line []byte) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last returns up to n of the most recent lines, oldest first.
+func (r *lineRing) last(n int) [][]byte {
+	count := r.next
+	if r.full {
+		count = len(r.lines)
+	}
+	if n > count {
+		n = count
+	}
+	var lines [][]byte
+	for i := r.next - n; i < r.next; i++ {
+		lines = append(lines, r.lines[(i+len(r.lines))%len(r.lines)])
+	}
+	return lines
+}
+
+// attachment is a writer attached to a process's output with Attach. Lines
+// are queued and written from the attachment's own goroutine, so a slow
+// writer doesn't hold up output.
+type attachment struct {
+	w     io.Writer
+	lines chan []byte   // Closed once the attachment is detached
+	done  chan struct{} // Closed once queued lines have all been written
+}
+
+// run writes queued lines to the attachment's writer until it's detached,
+// detaching it if a write fails.
+func (a *attachment) run(m *multiOutput, proc *process) {
+	defer close(a.done)
+	for line := range a.lines {
+		if _, err := a.w.Write(append(line, '\n')); err != nil {
+			m.detach(proc, a)
+			return
 		}
-		buf.WriteString(ansi.ColorEnd() + " ")
 	}
+}
+
+// Attach writes the last n lines of a process's output to w, then each line
+// written from then on, until detach is called or writing to w fails. Lines
+// are written from another goroutine, and if w falls more than
+// attachQueueSize lines behind, it's detached.
+func (m *multiOutput) Attach(proc *process, n int, w io.Writer) (detach func()) {
+	a := m.attach(proc, n, w)
+	return func() { m.detach(proc, a) }
+}
+
+func (m *multiOutput) attach(proc *process, n int, w io.Writer) *attachment {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var replay [][]byte
+	if tail := m.tails[proc]; tail != nil {
+		replay = tail.last(n)
+	}
+	a := &attachment{w: w, lines: make(chan []byte, len(replay)+attachQueueSize), done: make(chan struct{})}
+	for _, line := range replay {
+		a.lines <- append(make([]byte, 0, len(line)+1), line...)
+	}
+	if m.attached == nil {
+		m.attached = make(map[*process]map[*attachment]struct{})
+	}
+	if m.attached[proc] == nil {
+		m.attached[proc] = make(map[*attachment]struct{})
+	}
+	m.attached[proc][a] = struct{}{}
+	go a.run(m, proc)
+	return a
+}
+
+// detach stops writing lines to an attachment. Lines already queued are still
+// written.
+func (m *multiOutput) detach(proc *process, a *attachment) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeAttachment(proc, a)
+}
+
+// removeAttachment removes an attachment and closes its queue, if it hasn't
+// been already. The caller must hold the mutex.
+func (m *multiOutput) removeAttachment(proc *process, a *attachment) {
+	if _, ok := m.attached[proc][a]; ok {
+		delete(m.attached[proc], a)
+		close(a.lines)
+	}
+}
+
+// record keeps a line of output to be replayed by Attach, and queues it for
+// anything attached to the process. Attachments too far behind to queue the
+// line are detached.
+func (m *multiOutput) record(proc *process, p []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if tail := m.tails[proc]; tail != nil {
+		tail.add(append([]byte(nil), p...))
+	}
+	for a := range m.attached[proc] {
+		select {
+		case a.lines <- append(make([]byte, 0, len(p)+1), p...):
+		default:
+			m.removeAttachment(proc, a)
+		}
+	}
+}
 
+// writer returns where output is written.
+func (m *multiOutput) writer() io.Writer {
+	if m.out != nil {
+		return m.out
+	}
+	return os.Stdout
+}
+
+// Write writes p to the output as is, for commands run by the process
+// manager itself, so they aren't interleaved with lines from processes.
+func (m *multiOutput) Write(p []byte) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.writer().Write(p)
+}
+
+// WriteInput writes p to the terminal of a process, as if it were typed. It's
+// dropped if the process isn't running.
+func (m *multiOutput) WriteInput(proc *process, p []byte) {
+	pipe := m.pipe(proc)
+	if pipe == nil {
+		return
+	}
+	pipe.mu.Lock()
+	defer pipe.mu.Unlock()
+	if pipe.pty != nil {
+		pipe.pty.Write(p)
+	}
+}
+
+func (m *multiOutput) WriteLine(proc *process, p []byte) {
+	m.writeLine(proc, p, false)
+}
+
+// writeLine writes a line labelled with proc's name. Output filters only
+// apply if filter is set, so that tandem's own lines about a process, like
+// errors, are always shown.
+func (m *multiOutput) writeLine(proc *process, p []byte, filter bool) {
 	// We trim the "/bin/sh: " prefix from the output of the command
 	// since the fact that we're running things in the /bin/sh shell isn't
 	// super relevant.
-	buf.Write(bytes.TrimPrefix(p, []byte("/bin/sh: ")))
-	buf.WriteByte('\n')
+	p = bytes.TrimPrefix(p, []byte("/bin/sh: "))
+
+	// Log files get every line in full, regardless of what's shown.
+	if m.logger != nil {
+		if err := m.logger.Write(proc, p); err != nil {
+			fmt.Fprintf(m, "tandem: warning: %v\n", err)
+		}
+	}
+	m.record(proc, p)
+	if filter && !m.matchesFilters(p) {
+		return
+	}
 
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	buf.WriteTo(os.Stdout)
+	m.wroteLines = true
+
+	// The prefix counts towards the line length, so lines from processes
+	// with long names are cut shorter.
+	if n := m.maxLineLength; n > 0 {
+		if m.printProcName {
+			n -= m.prefixWidth()
+		}
+		if n < 1 {
+			n = 1
+		}
+		p = truncateLine(p, n)
+	}
+
+	// Without a prefix or wrapping, there's nothing to build up, so write
+	// the line directly.
+	if !m.printProcName && m.outputWidth <= 0 && m.orderWindow <= 0 {
+		w := m.writer()
+		w.Write(p)
+		w.Write(newline)
+		return
+	}
+
+	lines := [][]byte{p}
+	if m.outputWidth > 0 {
+		width := m.outputWidth
+		if m.printProcName {
+			width -= m.prefixWidth()
+		}
+		if width < minWrapWidth {
+			width = minWrapWidth
+		}
+		lines = wrapLine(p, width)
+	}
+
+	// Lines that wrap are indented to line up with the first, rather than
+	// being labelled again.
+	var buf bytes.Buffer
+	for i, line := range lines {
+		if m.printProcName && i == 0 {
+			m.writePrefix(&buf, proc)
+		} else if m.printProcName {
+			buf.WriteString(strings.Repeat(" ", m.prefixWidth()))
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if m.orderWindow > 0 {
+		m.queue(proc, buf.Bytes())
+		return
+	}
+	buf.WriteTo(m.writer())
+}
+
+// pendingLine is a line of output waiting to be written in order.
+type pendingLine struct {
+	proc *process
+	b    []byte
+}
+
+// queue adds output to be written once the order window is up, starting the
+// window if it isn't already running. The caller must hold the mutex.
+func (m *multiOutput) queue(proc *process, b []byte) {
+	m.pending = append(m.pending, pendingLine{proc: proc, b: b})
+	if m.flushTimer == nil {
+		m.flushTimer = time.AfterFunc(m.orderWindow, m.Flush)
+	}
+}
+
+// Flush writes any output queued by the order window, sorted by process name.
+// Lines from the same process keep their order.
+func (m *multiOutput) Flush() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.flushTimer != nil {
+		m.flushTimer.Stop()
+		m.flushTimer = nil
+	}
+	sort.SliceStable(m.pending, func(i, j int) bool {
+		return m.pending[i].proc.Name < m.pending[j].proc.Name
+	})
+	for _, line := range m.pending {
+		m.writer().Write(line.b)
+	}
+	m.pending = nil
+}
+
+var newline = []byte{'\n'}
+
+// writePrefix writes the colored, padded name of a process that's used to
+// label its output.
+func (m *multiOutput) writePrefix(buf *bytes.Buffer, proc *process) {
+	name := proc.Name + strings.Repeat(" ", m.maxNameLength-len(proc.Name)+1)
+	sep := m.separator()
+	switch m.prefixStyle {
+	case "none":
+		buf.WriteString(name + sep)
+	case "dim":
+		buf.WriteString(ansi.Dim(name) + sep)
+	default:
+		buf.WriteString(ansi.ColorStart(proc.Color) + name + ansi.ColorEnd() + sep)
+	}
+}
+
+// separator returns what's written between the name and output of each line.
+func (m *multiOutput) separator() string {
+	if m.prefixSep != "" {
+		return m.prefixSep
+	}
+	if m.prefixStyle == "none" {
+		return "| "
+	}
+	return " "
+}
+
+// prefixWidth returns the number of columns taken up by the prefix of each
+// line.
+func (m *multiOutput) prefixWidth() int {
+	return m.maxNameLength + 1 + utf8.RuneCountInString(m.separator())
+}
+
+// WriteBanner writes a summary of each process's name and command, all at
+// once so it isn't interleaved with process output.
+func (m *multiOutput) WriteBanner(procs []*process) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var buf bytes.Buffer
+	for _, proc := range procs {
+		m.writePrefix(&buf, proc)
+		buf.WriteString(ansi.Dim(proc.command))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteTo(m.writer())
 }
 
 func (m *multiOutput) WriteErr(proc *process, err error) {
-	m.WriteLine(proc, []byte(ansi.Red(err.Error())))
+	m.WriteLine(proc, []byte(m.colorErr(proc, err.Error())))
+}
+
+// colorErr colors an error or line of stderr from proc, in red unless another
+// color was set.
+func (m *multiOutput) colorErr(proc *process, s string) string {
+	switch {
+	case m.stderrColor == nil:
+		return ansi.Red(s)
+	case *m.stderrColor == -1:
+		return ansi.ColorStart(proc.Color) + s + ansi.ColorEnd()
+	}
+	return ansi.ColorStart(*m.stderrColor) + s + ansi.ColorEnd()
+}
+
+// matchesFilters reports whether a line should be written, given the
+// configured output filters and excludes. Lines are matched without their
+// ANSI escape codes.
+func (m *multiOutput) matchesFilters(p []byte) bool {
+	if len(m.filters) == 0 && len(m.excludes) == 0 {
+		return true
+	}
+	if bytes.IndexByte(p, '\x1b') >= 0 {
+		p = []byte(ansi.Strip(string(p)))
+	}
+	for _, re := range m.excludes {
+		if re.Match(p) {
+			return false
+		}
+	}
+	if len(m.filters) == 0 {
+		return true
+	}
+	for _, re := range m.filters {
+		if re.Match(p) {
+			return true
+		}
+	}
+	return false
 }
 
+// truncateLine shortens p to at most n characters, marking it as truncated.
+// Like wrapLine, ANSI escape sequences don't count towards its length, and
+// are never split. If n is 0 or less, p is returned unchanged.
+func truncateLine(p []byte, n int) []byte {
+	if n <= 0 || len(p) <= n {
+		return p
+	}
+	col := 0
+	for i := 0; i < len(p); {
+		if p[i] == '\x1b' {
+			i += escapeLen(p[i:])
+			continue
+		}
+		if col == n {
+			out := make([]byte, 0, i+32)
+			out = append(out, p[:i]...)
+			return append(out, ansi.Dim("… [truncated]")...)
+		}
+		_, size := utf8.DecodeRune(p[i:])
+		col++
+		i += size
+	}
+	return p
+}
+
+// minWrapWidth is the fewest columns lines are wrapped to, even if the prefix
+// leaves less room than that.
+const minWrapWidth = 10
+
+// wrapLine splits p into lines of at most width characters. ANSI escape
+// sequences don't count towards the width, and are never split.
+func wrapLine(p []byte, width int) [][]byte {
+	var lines [][]byte
+	start, col := 0, 0
+	for i := 0; i < len(p); {
+		if p[i] == '\x1b' {
+			i += escapeLen(p[i:])
+			continue
+		}
+		_, size := utf8.DecodeRune(p[i:])
+		if col == width {
+			lines = append(lines, p[start:i])
+			start, col = i, 0
+		}
+		col++
+		i += size
+	}
+	return append(lines, p[start:])
+}
+
+// escapeLen returns the length of the ANSI escape sequence at the start of p.
+func escapeLen(p []byte) int {
+	if len(p) < 2 {
+		return len(p)
+	}
+	if p[1] != '[' {
+		return 2
+	}
+	for i := 2; i < len(p); i++ {
+		if p[i] >= 0x40 && p[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(p)
+}
+
+// maxLineBytes is the most bytes of a line that scanLines buffers before
+// passing it on. Longer lines are split into chunks, each marked with
+// lineContinuation, so that huge lines don't use unbounded memory.
+const maxLineBytes = 4096
+
+// lineContinuation marks a chunk of a line that continues in the next chunk.
+const lineContinuation = " [...]"
+
 func scanLines(r io.Reader, callback func([]byte) bool) error {
 	var (
 		err      error
@@ -117,12 +756,16 @@ func scanLines(r io.Reader, callback func([]byte) bool) error {
 
 		buf.Write(line)
 
-		if !isPrefix {
-			if !callback(buf.Bytes()) {
-				return nil
-			}
-			buf.Reset()
+		if isPrefix && buf.Len() < maxLineBytes {
+			continue
+		}
+		if isPrefix {
+			buf.WriteString(lineContinuation)
+		}
+		if !callback(buf.Bytes()) {
+			return nil
 		}
+		buf.Reset()
 	}
 	if err != io.EOF && err != io.ErrClosedPipe {
 		return err
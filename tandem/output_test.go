@@ -0,0 +1,385 @@
+package tandem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rosszurowski/tandem/ansi"
+	"golang.org/x/exp/slices"
+)
+
+func TestTruncateLine(t *testing.T) {
+	ansi.NoColor = true
+	tests := []struct {
+		input string
+		n     int
+		want  string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello… [truncated]"},
+		{"héllo", 2, "hé… [truncated]"},
+		{"héllo", 5, "héllo"},
+		{"\x1b[31mhello\x1b[0m", 5, "\x1b[31mhello\x1b[0m"},
+		{"\x1b[31mhello\x1b[0m world", 3, "\x1b[31mhel… [truncated]"},
+		{"hi \x1b[31mthere\x1b[0m", 3, "hi \x1b[31m… [truncated]"},
+	}
+
+	for _, tt := range tests {
+		got := string(truncateLine([]byte(tt.input), tt.n))
+		if got != tt.want {
+			t.Errorf("truncateLine(%q, %d) = %q, want %q", tt.input, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesFilters(t *testing.T) {
+	m := &multiOutput{
+		filters:  []*regexp.Regexp{regexp.MustCompile("ERROR"), regexp.MustCompile("WARN")},
+		excludes: []*regexp.Regexp{regexp.MustCompile("ignored")},
+	}
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"ERROR: bad", true},
+		{"WARN: meh", true},
+		{"INFO: ok", false},
+		{"ERROR: ignored", false},
+		{"\x1b[31mERROR\x1b[0m: bad", true},
+		{"ERR\x1b[1mOR\x1b[0m: bad", true},
+	}
+
+	for _, tt := range tests {
+		got := m.matchesFilters([]byte(tt.input))
+		if got != tt.want {
+			t.Errorf("matchesFilters(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWriteLineFilters(t *testing.T) {
+	m := &multiOutput{
+		filters:  []*regexp.Regexp{regexp.MustCompile("^ERROR")},
+		excludes: []*regexp.Regexp{regexp.MustCompile("ignored$")},
+	}
+	proc := &process{Name: "api"}
+	ansi.NoColor = true
+	out, err := captureStdout(func() {
+		m.writeOutput(proc, []byte("\x1b[31mERROR\x1b[0m: bad"))
+		m.writeOutput(proc, []byte("INFO: ok"))
+		m.writeOutput(proc, []byte("ERROR: \x1b[2mignored\x1b[0m"))
+		m.WriteErr(proc, errors.New("exit status 1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x1b[31mERROR\x1b[0m: bad\nexit status 1\n"; out != want {
+		t.Fatalf("expected only matching process output and tandem's errors, got %q, want %q", out, want)
+	}
+}
+
+func TestScanLinesLongLine(t *testing.T) {
+	input := strings.Repeat("a", maxLineBytes*2+10) + "\nshort\n"
+	var got []string
+	err := scanLines(strings.NewReader(input), func(b []byte) bool {
+		got = append(got, string(b))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		strings.Repeat("a", maxLineBytes) + lineContinuation,
+		strings.Repeat("a", maxLineBytes) + lineContinuation,
+		strings.Repeat("a", 10),
+		"short",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("scanLines: got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("scanLines: line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriteLineWithoutPrefix(t *testing.T) {
+	m := &multiOutput{maxLineLength: 5}
+	proc := &process{Name: "api"}
+	ansi.NoColor = true
+	out, err := captureStdout(func() {
+		m.WriteLine(proc, []byte("hello world"))
+		m.WriteLine(proc, []byte("/bin/sh: oops"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello… [truncated]\noops\n"; out != want {
+		t.Fatalf("WriteLine() wrote %q, want %q", out, want)
+	}
+}
+
+func TestWriteLineTruncatesPrefix(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	m := &multiOutput{maxLineLength: 12, printProcName: true, maxNameLength: 3, out: &buf}
+	m.WriteLine(&process{Name: "api"}, []byte("hello world"))
+	if want := "api  hello w… [truncated]\n"; buf.String() != want {
+		t.Fatalf("WriteLine() wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWritePrefix(t *testing.T) {
+	ansi.NoColor = true
+	proc := &process{Name: "api"}
+	tests := []struct {
+		style, sep, want string
+	}{
+		{"color", "", "api     "},
+		{"none", "", "api    | "},
+		{"color", "| ", "api    | "},
+		{"dim", "> ", "api    > "},
+	}
+	for _, tt := range tests {
+		m := &multiOutput{maxNameLength: 6, prefixStyle: tt.style, prefixSep: tt.sep}
+		var buf bytes.Buffer
+		m.writePrefix(&buf, proc)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("writePrefix(%q, %q) = %q, want %q", tt.style, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		input string
+		width int
+		want  []string
+	}{
+		{"", 3, []string{""}},
+		{"abc", 3, []string{"abc"}},
+		{"abcdefg", 3, []string{"abc", "def", "g"}},
+		{"héllo", 2, []string{"hé", "ll", "o"}},
+		{"\033[31mabcd\033[0m", 2, []string{"\033[31mab", "cd\033[0m"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, line := range wrapLine([]byte(tt.input), tt.width) {
+			got = append(got, string(line))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("wrapLine(%q, %d) = %q, want %q", tt.input, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestWriteLineWrapped(t *testing.T) {
+	ansi.NoColor = true
+	m := &multiOutput{maxNameLength: 3, printProcName: true, outputWidth: 15}
+	proc := &process{Name: "api"}
+	out, err := captureStdout(func() {
+		m.WriteLine(proc, []byte("0123456789abcdef"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "api  0123456789\n     abcdef\n"; out != want {
+		t.Fatalf("WriteLine() wrote %q, want %q", out, want)
+	}
+}
+
+func TestConnectExpandsNames(t *testing.T) {
+	ansi.NoColor = true
+	m := &multiOutput{printProcName: true}
+	api, worker := &process{Name: "api"}, &process{Name: "worker"}
+	out, err := captureStdout(func() {
+		m.Connect(api)
+		m.WriteLine(api, []byte("a"))
+		m.Connect(worker)
+		m.WriteLine(api, []byte("b"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "api  a\n--- name column expanded ---\napi     b\n"; out != want {
+		t.Fatalf("got output %q, want %q", out, want)
+	}
+}
+
+func TestOrderedOutput(t *testing.T) {
+	ansi.NoColor = true
+	m := &multiOutput{maxNameLength: 1, printProcName: true, orderWindow: time.Hour}
+	a, b := &process{Name: "a"}, &process{Name: "b"}
+	out, err := captureStdout(func() {
+		m.WriteLine(b, []byte("1"))
+		m.WriteLine(a, []byte("2"))
+		m.WriteLine(b, []byte("3"))
+		m.Flush()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a  2\nb  1\nb  3\n"; out != want {
+		t.Fatalf("got output %q, want %q", out, want)
+	}
+}
+
+func TestColorErr(t *testing.T) {
+	ansi.NoColor = false
+	defer func() { ansi.NoColor = true }()
+	color := func(c int) *int { return &c }
+	proc := &process{Name: "api", Color: 42}
+	tests := []struct {
+		color *int
+		want  string
+	}{
+		{nil, ansi.Red("oops")},
+		{color(208), "\033[0;38;5;208moops\033[0m"},
+		{color(0), "\033[0;38;5;0moops\033[0m"},
+		{color(-1), "\033[0;38;5;42moops\033[0m"},
+	}
+	for _, tt := range tests {
+		if got := (&multiOutput{stderrColor: tt.color}).colorErr(proc, "oops"); got != tt.want {
+			t.Errorf("colorErr() with %v = %q, want %q", tt.color, got, tt.want)
+		}
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, StderrColor: color(-2)}); err == nil {
+		t.Error("New: expected error for invalid stderr color")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	r := newRateLimiter(2)
+	for i, want := range []bool{true, true, false, false} {
+		if ok, _ := r.allow(); ok != want {
+			t.Fatalf("allow() call %d = %v, want %v", i, ok, want)
+		}
+	}
+
+	r.last = r.last.Add(-time.Second)
+	ok, dropped := r.allow()
+	if !ok || dropped != 2 {
+		t.Fatalf("allow() after refill = %v, %d, want true, 2", ok, dropped)
+	}
+	if dropped := r.takeDropped(); dropped != 0 {
+		t.Fatalf("takeDropped() = %d, want 0", dropped)
+	}
+}
+
+func TestLineRing(t *testing.T) {
+	r := newLineRing(3)
+	if got := r.last(5); len(got) != 0 {
+		t.Fatalf("last() on empty ring = %q, want nothing", got)
+	}
+	for _, s := range []string{"a", "b", "c", "d"} {
+		r.add([]byte(s))
+	}
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, ""},
+		{2, "c d"},
+		{3, "b c d"},
+		{10, "b c d"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, line := range r.last(tt.n) {
+			got = append(got, string(line))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("last(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// lineWriter sends each write to a channel, so tests can wait for lines
+// written from another goroutine.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+// blockingWriter blocks writes until it's closed, then fails them.
+type blockingWriter chan struct{}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	<-w
+	return 0, io.ErrClosedPipe
+}
+
+func TestAttach(t *testing.T) {
+	ansi.NoColor = true
+	m := &multiOutput{tailLines: 2}
+	api := &process{Name: "api"}
+	w := make(lineWriter, 10)
+	_, err := captureStdout(func() {
+		m.Connect(api)
+		m.WriteLine(api, []byte("1"))
+		m.WriteLine(api, []byte("2"))
+		m.WriteLine(api, []byte("3"))
+		detach := m.Attach(api, 5, w)
+		m.WriteLine(api, []byte("4"))
+		detach()
+		m.WriteLine(api, []byte("5"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		select {
+		case line := <-w:
+			got = append(got, line)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for attached output, got %q", got)
+		}
+	}
+	if want := []string{"2\n", "3\n", "4\n"}; !slices.Equal(got, want) {
+		t.Fatalf("got attached output %q, want %q", got, want)
+	}
+	select {
+	case line := <-w:
+		t.Fatalf("got output %q after detaching", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAttachSlowWriter(t *testing.T) {
+	ansi.NoColor = true
+	m := &multiOutput{}
+	api := &process{Name: "api"}
+	// The first write blocks until the test ends, so lines queue up behind
+	// it.
+	release := make(chan struct{})
+	defer close(release)
+	w := blockingWriter(release)
+	_, err := captureStdout(func() {
+		m.Connect(api)
+		m.Attach(api, 0, w)
+		for i := 0; i < attachQueueSize+10; i++ {
+			m.WriteLine(api, []byte("line"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mutex.Lock()
+	n := len(m.attached[api])
+	m.mutex.Unlock()
+	if n != 0 {
+		t.Fatal("expected a writer that fell behind to be detached")
+	}
+}
@@ -0,0 +1,25 @@
+package tandem
+
+import "sync"
+
+// parallel calls fn with each index from 0 to n at once, and waits for them
+// all to return. It returns the first error in index order, so that the same
+// error is reported from run to run.
+func parallel(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
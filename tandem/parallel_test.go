@@ -0,0 +1,50 @@
+package tandem
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	// Each call waits for every other one to start, so this only finishes
+	// if they all run at once.
+	const n = 20
+	var started sync.WaitGroup
+	started.Add(n)
+	results := make([]int, n)
+	done := make(chan error)
+	go func() {
+		done <- parallel(n, func(i int) error {
+			started.Done()
+			started.Wait()
+			results[i] = i * 2
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected calls to run at once")
+	}
+	for i, got := range results {
+		if got != i*2 {
+			t.Fatalf("got result %d for call %d, want %d", got, i, i*2)
+		}
+	}
+
+	err := parallel(5, func(i int) error {
+		if i >= 2 {
+			time.Sleep(time.Duration(5-i) * 10 * time.Millisecond)
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed 2" {
+		t.Fatalf("expected the first error in order, got %v", err)
+	}
+}
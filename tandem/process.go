@@ -3,126 +3,2080 @@
 package tandem
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/rosszurowski/tandem/ansi"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
-var colors = []int{2, 3, 4, 5, 6, 42, 130, 103, 129, 108}
+// colors is the palette of ANSI color indexes used to label process output.
+// It's only reused once there are more than 20 processes.
+var colors = []int{
+	2, 3, 4, 5, 6, 42, 130, 103, 129, 108,
+	33, 166, 37, 161, 71, 178, 61, 168, 31, 143,
+}
 
 // ProcessManager manages a set of processes, combining their output and exiting
 // all of them gracefully when one of them exits.
 type ProcessManager struct {
 	output      *multiOutput
-	procs       []*process
+	procs       []*process // Guarded by procsMu once running
+	procsMu     sync.RWMutex
 	procWg      sync.WaitGroup
-	done        chan bool
+	done        chan *process
+	stop        <-chan struct{}
+	exitMu      sync.Mutex
+	firstExit   *process  // The process that exited first, causing shutdown
+	exitSignal  os.Signal // The signal that interrupted tandem, causing shutdown
 	interrupted chan os.Signal
 	timeout     time.Duration
+	killTimeout time.Duration // Time between terminating and killing processes
 	silent      bool
+	noBanner    bool
+	noAutoExit  bool
+	shutdown    chan struct{}
+	lockPath    string // Where to write the lock file, if anywhere
+	controlPath string // Where to listen for control commands, if anywhere
+	exitPath    string // Where to write the exit code, if anywhere
+	root        string
+	env         []string // Environment for commands run by the process manager itself
+	shell       string
+	onAllExit   string
+	onFirstExit string
+	exitCmdWg   sync.WaitGroup // Waits for the on-first-exit command
+	finished    chan struct{}  // Closed once piped commands have all exited
+
+	cfg                Config    // Used to create processes for piped commands
+	palette            []int     // Colors picked from for each process
+	pipe               io.Reader // Commands to start as they're read, if set
+	pipeClosed         bool      // Whether no more piped commands are started, guarded by procsMu
+	running            bool      // Whether run has started processes, guarded by procsMu
+	stdinProc          *process
+	creds              map[string]*syscall.Credential // Looked up for each user, guarded by credsMu
+	credsMu            sync.Mutex
+	shutdownOnce       *sync.Once
+	stdinEcho          bool
+	stdinBroadcast     bool
+	passthroughSignals []os.Signal
+	watchdogTimeout    time.Duration
+	heartbeatInterval  time.Duration
+	metricsAddr        string
+	metricsInterval    time.Duration
+	restartOnError     bool
+	restartOnCleanExit bool
+	maxRestarts        int
+	restartWindow      time.Duration
+	maxWindowRestarts  int
+}
+
+// Config is the configuration for a process manager.
+type Config struct {
+	Cmds          []string // Shell commands to run
+	Shell         string   // Path to the shell commands are run with. Defaults to /bin/sh.
+	Root          string   // Root directory for commands to run from
+	Timeout       int      // Timeout in seconds for commands to exit gracefully before being killed. Defaults to 0.
+	Silent        bool     // Whether to silence process management messages like "Starting..."
+	MaxLineLength int      // Maximum length in visible characters of an output line, including its prefix but not escape codes, before it's truncated. Defaults to 0 (unlimited).
+	MaxOutputRate int      // Maximum lines per second of output shown for each process; the rest are dropped. Defaults to 0 (unlimited).
+
+	// OutputFilter limits output to lines matching at least one of the given
+	// patterns. If empty, all lines are shown.
+	OutputFilter []*regexp.Regexp
+	// OutputExclude hides output lines matching any of the given patterns.
+	OutputExclude []*regexp.Regexp
+	// WatchdogTimeout restarts a process if it hasn't produced any output
+	// within the given duration. Defaults to 0 (disabled).
+	WatchdogTimeout time.Duration
+	// HeartbeatInterval writes a status line at the given interval saying
+	// which processes are still running, until they've all exited. Defaults
+	// to 0 (disabled).
+	HeartbeatInterval time.Duration
+	// MetricsAddr serves the memory and CPU usage of each process at /metrics
+	// on the given address, in the Prometheus text format. Defaults to ""
+	// (disabled).
+	MetricsAddr string
+	// MetricsInterval is how often memory and CPU usage is sampled for
+	// MetricsAddr. Defaults to 5s.
+	MetricsInterval time.Duration
+	// StartTimeout warns if a process hasn't produced any output within the
+	// given duration of starting, since it may be stuck. Defaults to 0
+	// (disabled).
+	StartTimeout time.Duration
+	// StartTimeoutKill kills processes that hit their StartTimeout, rather
+	// than only warning about them.
+	StartTimeoutKill bool
+	// PreStartHook is called with the name and command of each process before
+	// it starts. If it returns an error, the process isn't started.
+	PreStartHook func(name, cmd string) error
+	// PostExitHook is called with the name and exit code of each process after
+	// it exits. It runs in the background, and isn't waited on for longer than
+	// a few seconds so it can't hold up shutdown.
+	PostExitHook func(name string, exitCode int)
+	// Timeouts overrides Timeout for individual processes, keyed by process
+	// name.
+	Timeouts map[string]int
+	// NpxArgs are extra arguments passed to npx for commands prefixed with
+	// 'npx:', like "--yes".
+	NpxArgs []string
+	// BunArgs are extra arguments passed to 'bun run' for commands prefixed
+	// with 'bun:'.
+	BunArgs []string
+	// RestartOnError restarts processes that exit with a non-zero exit code.
+	RestartOnError bool
+	// RestartOnCleanExit restarts processes that exit with a zero exit code.
+	RestartOnCleanExit bool
+	// MaxRestarts limits how many times each process is restarted before
+	// giving up. Defaults to 0 (unlimited).
+	MaxRestarts int
+	// MaxRestartWindow and MaxRestartsPerWindow limit how quickly each
+	// process is restarted: once it's been restarted MaxRestartsPerWindow
+	// times within MaxRestartWindow, tandem gives up on it rather than
+	// restarting it again. Both default to 0 (unlimited).
+	MaxRestartWindow     time.Duration
+	MaxRestartsPerWindow int
+	// Processes are processes to run in addition to Cmds, with more detailed
+	// configuration for each one. They're listed before any Cmds.
+	Processes []ProcessConfig
+	// SeparateStderr pipes stderr separately from stdout rather than through
+	// the process's terminal, and prints its lines in red.
+	SeparateStderr bool
+	// TailLines is how many recent lines of each process's output are kept in
+	// memory, to be replayed by Attach. Defaults to 0 (defaultTailLines).
+	TailLines int
+	// StderrColor is the ANSI color index used for stderr lines, when
+	// SeparateStderr is set, and for errors, or -1 to use each process's own
+	// color. Defaults to nil (red).
+	StderrColor *int
+	// DisableNodeBin stops node_modules/.bin directories from being added to
+	// the PATH of each process.
+	DisableNodeBin bool
+	// NodeBinPaths overrides which directories are added to the PATH of each
+	// process. By default, every node_modules/.bin between a process's
+	// directory and the root is added, closest first.
+	NodeBinPaths []string
+	// StdinProcess is the name of a process to forward stdin to, so it can
+	// be used interactively. By default, no process receives input.
+	StdinProcess string
+	// StdinBroadcast forwards stdin to every process at once, rather than to
+	// StdinProcess, like for sending the same keypress to several watchers.
+	// Input for a process that falls behind reading it is dropped.
+	StdinBroadcast bool
+	// PrependNameToStdin echoes each line of input forwarded to the stdin
+	// process, labelled with its name, so it's clear where input went.
+	PrependNameToStdin bool
+	// NoBanner stops a summary of each process's name and command from being
+	// printed before they start. It's never printed if Silent is set.
+	NoBanner bool
+	// ColorByHash picks each process's color from a hash of its name, rather
+	// than its position, so it stays the same between runs.
+	ColorByHash bool
+	// NoPackageJSONWalk only looks for package.json in the root directory,
+	// rather than also searching its parents.
+	NoPackageJSONWalk bool
+	// SkipMissingWorkspaceScripts skips workspace packages that don't have
+	// the script given in a "workspace:<name>:<script>" command, with a
+	// warning, rather than returning an error.
+	SkipMissingWorkspaceScripts bool
+	// InjectPackageVersion sets APP_VERSION for each process to the version
+	// in package.json, if there is one.
+	InjectPackageVersion bool
+	// KillSignal is the name of the signal sent to processes that haven't
+	// exited once their timeout is up: SIGKILL, SIGTERM, or SIGQUIT. Defaults
+	// to SIGKILL.
+	KillSignal string
+	// InterruptSignal is the name of the signal sent to ask processes to exit
+	// gracefully, like SIGTERM or SIGUSR1. Defaults to SIGINT.
+	InterruptSignal string
+	// PrefixStyle controls how the process name labelling each line is
+	// rendered: "color" (the default), "dim", or "none" for plain text.
+	PrefixStyle string
+	// PrefixSeparator is written between the process name and each line of
+	// output, without any color. Defaults to a space, or "| " when
+	// PrefixStyle is "none".
+	PrefixSeparator string
+	// OutputWidth wraps lines of output at the given column, including the
+	// prefix. Wrapped lines are indented rather than labelled again.
+	// Defaults to 0 (no wrapping).
+	OutputWidth int
+	// UseNvm adds the bin directory of the node version given in the root's
+	// .nvmrc or .node-version file to the PATH of each process, if it's
+	// installed with nvm.
+	UseNvm bool
+	// NoAutoExit keeps the process manager running after processes exit,
+	// until it's interrupted.
+	NoAutoExit bool
+	// Exec runs commands directly rather than through /bin/sh, splitting them
+	// into arguments with shell-like quoting. Commands can't use shell
+	// features like pipes or variables, and npm scripts aren't supported.
+	Exec bool
+	// LogDir is a directory to also write each process's output to, in a
+	// file named after the process. Log files never include ANSI escape
+	// sequences. The directory is created when processes start running. By
+	// default, output isn't logged to files.
+	LogDir string
+	// LogFormat controls how lines are written to files in LogDir: "text"
+	// (the default) for "[time] [name] line", or "json" for one JSON object
+	// per line.
+	LogFormat string
+	// Ports sets the PORT environment variable of processes, keyed by process
+	// name. Each port can only be given to one process.
+	Ports map[string]int
+	// BasePort sets the PORT environment variable of processes not in Ports
+	// to BasePort for the first process, BasePort+1 for the second, and so
+	// on. Defaults to 0 (disabled).
+	BasePort int
+	// Exclude lists the names of processes not to run.
+	Exclude []string
+	// ReadyStrings mark processes as ready the first time a line of their
+	// output contains the given string, keyed by process name. See
+	// ProcessManager.Ready.
+	ReadyStrings map[string]string
+	// IgnoreExitCodes are exit codes treated the same as a clean exit: they
+	// aren't reported as errors, don't cause restarts on error, and don't
+	// count as a failure in RunAll.
+	IgnoreExitCodes []int
+	// Dirs sets the directories of processes, keyed by process name.
+	// Relative paths are relative to Root. These override any directory set
+	// in Processes.
+	Dirs map[string]string
+	// NameFromDir names processes in Processes that have a directory but no
+	// name after their directory, rather than their command. Useful in
+	// monorepos, where every package runs the same command.
+	NameFromDir bool
+	// Users runs processes as other Unix users, keyed by process name, which
+	// needs tandem to run as root or with CAP_SETUID. These override any
+	// user set in Processes or with a "user(name):" prefix.
+	Users map[string]string
+	// ReadyPorts mark processes as ready once something accepts TCP
+	// connections on the given port on 127.0.0.1, keyed by process name. See
+	// ProcessManager.Ready.
+	ReadyPorts map[string]int
+	// NoInheritEnv starts processes with a clean environment, containing only
+	// PATH and the variables set for each process, rather than inheriting
+	// the environment of the process manager.
+	NoInheritEnv bool
+	// AllowedScripts lists the npm scripts that wildcards like 'npm:dev:*'
+	// can expand to when OnlyNamed is set. It's usually read from the
+	// allowed_scripts list in a config file.
+	AllowedScripts []string
+	// IgnoreFile is a file listing patterns of npm scripts, one per line,
+	// that wildcards like 'npm:dev:*' never expand to. Relative paths are
+	// from the root. Defaults to .tandemignore in the root, if it exists.
+	IgnoreFile string
+	// OnlyNamed limits npm wildcard expansion to scripts in AllowedScripts,
+	// so new scripts aren't run without being opted in. It has no effect if
+	// AllowedScripts is empty. Scripts named exactly are always run.
+	OnlyNamed bool
+	// RaceDetect adds -race to Go commands that support it, like 'go run'
+	// and 'go test'. Other commands are unaffected.
+	RaceDetect bool
+	// Colors is the palette of 256-color ANSI indexes that process colors
+	// are picked from. It takes precedence over the TANDEM_COLORS
+	// environment variable, a comma-separated list of indexes. By default,
+	// a built-in palette is used.
+	Colors []int
+	// KillTimeout adds a step to shutdown: once a process's timeout is up,
+	// it's sent SIGTERM and given this many more seconds to exit before
+	// being sent the kill signal. Defaults to 0 (kill right away).
+	KillTimeout int
+	// LockFilePath is where a JSON file describing the running process
+	// manager is written while it runs, so other tools can find it. Relative
+	// paths are resolved from the root. Defaults to .tandem.lock in the root.
+	LockFilePath string
+	// NoLockFile stops the lock file from being written.
+	NoLockFile bool
+	// ControlSocket is the path of a Unix socket to accept commands on while
+	// running, like signalling a group of processes. Relative paths are
+	// resolved from the root. By default, there's no control socket.
+	ControlSocket string
+	// ExitCodeFile is where the exit code of the run is written once
+	// everything has exited, for CI systems that can't read it otherwise.
+	// It's the exit code of the process that caused shutdown if it failed,
+	// 128 plus the signal number if tandem was interrupted, and 0 otherwise.
+	// Relative paths are from the root.
+	ExitCodeFile string
+	// Groups tags processes with group names, mapping each group to the
+	// names of the processes in it, so they can be signalled together with
+	// SignalGroup or through the control socket. These are added to any
+	// groups set in Processes.
+	Groups map[string][]string
+	// OnAllExit is a shell command run from the root once every process has
+	// exited, for cleanup. Its exit code is reported but doesn't affect the
+	// result of Run.
+	OnAllExit string
+	// OnFirstExit is a shell command run from the root when the first
+	// process exits on its own, like for a notification. It's given the
+	// process's name and exit code in the TANDEM_PROC_NAME and
+	// TANDEM_EXIT_CODE environment variables.
+	OnFirstExit string
+	// PassthroughSignals are signals, like SIGUSR1 or SIGHUP, that are
+	// forwarded to every running process when tandem receives them, without
+	// shutting anything down. SIGINT and SIGTERM can't be passed through,
+	// since they're used for shutdown.
+	PassthroughSignals []os.Signal
+	// OrderedOutput buffers output briefly and writes each batch sorted by
+	// process name, so lines written at about the same time are grouped
+	// rather than interleaved.
+	OrderedOutput bool
+	// SortByName starts processes in alphabetical order of their names,
+	// rather than the order they're given in, so colors and ports are
+	// assigned the same way however they're listed.
+	SortByName bool
+	// ShutdownMessages customizes what's printed as processes are shut down.
+	ShutdownMessages ShutdownMessages
+}
+
+// ShutdownMessages are the messages printed for each process as it's shut
+// down. Each is a template, where {name} is replaced with the process's name
+// and {timeout} with how long it has to exit. Empty messages use the default.
+type ShutdownMessages struct {
+	Interrupting string // Printed when a process is asked to exit. Defaults to "Interrupting...".
+	Killing      string // Printed when a process is killed. Defaults to "Killing...".
+	TimedOut     string // Printed when a process's timeout is up, before it's killed. Not printed by default.
+}
+
+// format fills in the placeholders of a shutdown message template for a
+// process, falling back to def if the template is empty.
+func (m ShutdownMessages) format(template, def string, p *process) string {
+	if template == "" {
+		template = def
+	}
+	return strings.NewReplacer("{name}", p.Name, "{timeout}", p.timeout.String()).Replace(template)
+}
+
+const (
+	// postExitHookTimeout is the maximum time to wait for a PostExitHook to
+	// return before moving on.
+	postExitHookTimeout = 5 * time.Second
+	// stdinQueueSize is how many reads of stdin can be waiting to be written
+	// to each process before further input to it is dropped.
+	stdinQueueSize = 64
+	// restartDelay is how long to wait before restarting a process that
+	// exited, so a command that fails immediately doesn't spin.
+	restartDelay = 1 * time.Second
+	// defaultShell is the shell commands are run with if no other is given.
+	defaultShell = "/bin/sh"
+	// readyPortInterval is how often a process's ready port is checked.
+	readyPortInterval = 100 * time.Millisecond
+	// watchInterval is how often files matching each process's watch globs
+	// are checked for changes.
+	watchInterval = 500 * time.Millisecond
+	// orderedOutputWindow is how long output is buffered for before being
+	// sorted and written, with OrderedOutput.
+	orderedOutputWindow = 50 * time.Millisecond
+	// defaultTailLines is how many lines of each process's output are kept
+	// for Attach, if TailLines isn't set.
+	defaultTailLines = 100
+	// attachQueueSize is how many lines can be waiting to be written to a
+	// writer given to Attach before it's detached for falling behind.
+	attachQueueSize = 1024
+)
+
+// New creates a new process manager with the given configuration, writing
+// output to os.Stdout. If the configuration is invalid, the error is a
+// *ConfigError.
+func New(cfg Config) (*ProcessManager, error) {
+	return NewWithWriter(cfg, nil)
+}
+
+// NewWithWriter is like New, but writes output to w rather than os.Stdout,
+// for example to capture it in tests. If w is nil, output goes to whatever
+// os.Stdout is when it's written.
+func NewWithWriter(cfg Config, w io.Writer) (*ProcessManager, error) {
+	pm, err := newProcessManager(cfg, w)
+	if err != nil {
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			err = &ConfigError{Kind: ErrKindInvalidOption, Detail: err.Error()}
+		}
+		return nil, err
+	}
+	return pm, nil
+}
+
+func newProcessManager(cfg Config, w io.Writer) (*ProcessManager, error) {
+	root, err := resolveRoot(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.PrefixStyle {
+	case "", "color", "dim", "none":
+	default:
+		return nil, fmt.Errorf("invalid prefix style %q, expected color, dim, or none", cfg.PrefixStyle)
+	}
+	for _, sig := range cfg.PassthroughSignals {
+		if sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == os.Interrupt {
+			return nil, fmt.Errorf("can't pass through %v, since it's used to shut down", sig)
+		}
+	}
+	if c := cfg.StderrColor; c != nil && *c != -1 && !ansi.IsValidColor(*c) {
+		return nil, fmt.Errorf("invalid stderr color %d, expected -1 or a number from 0 to 255", *c)
+	}
+
+	pm := &ProcessManager{
+		output: &multiOutput{
+			out:           w,
+			printProcName: true,
+			maxLineLength: cfg.MaxLineLength,
+			filters:       cfg.OutputFilter,
+			excludes:      cfg.OutputExclude,
+			separateErr:   cfg.SeparateStderr,
+			prefixStyle:   cfg.PrefixStyle,
+			prefixSep:     cfg.PrefixSeparator,
+			outputWidth:   cfg.OutputWidth,
+			maxRate:       cfg.MaxOutputRate,
+			stderrColor:   cfg.StderrColor,
+			tailLines:     cfg.TailLines,
+		},
+		procs:              make([]*process, 0),
+		timeout:            time.Duration(cfg.Timeout) * time.Second,
+		killTimeout:        time.Duration(cfg.KillTimeout) * time.Second,
+		silent:             cfg.Silent,
+		noBanner:           cfg.NoBanner,
+		noAutoExit:         cfg.NoAutoExit,
+		watchdogTimeout:    cfg.WatchdogTimeout,
+		heartbeatInterval:  cfg.HeartbeatInterval,
+		metricsAddr:        cfg.MetricsAddr,
+		metricsInterval:    cfg.MetricsInterval,
+		restartOnError:     cfg.RestartOnError,
+		restartOnCleanExit: cfg.RestartOnCleanExit,
+		maxRestarts:        cfg.MaxRestarts,
+		restartWindow:      cfg.MaxRestartWindow,
+		maxWindowRestarts:  cfg.MaxRestartsPerWindow,
+		passthroughSignals: cfg.PassthroughSignals,
+	}
+
+	if cfg.MaxRestartWindow < 0 || cfg.MaxRestartsPerWindow < 0 {
+		return nil, fmt.Errorf("restart rate limits must be 0 or above")
+	}
+	if (cfg.MaxRestartWindow > 0) != (cfg.MaxRestartsPerWindow > 0) {
+		return nil, fmt.Errorf("MaxRestartWindow and MaxRestartsPerWindow must be set together")
+	}
+	if cfg.MetricsInterval < 0 {
+		return nil, fmt.Errorf("invalid metrics interval %v, expected a positive duration", cfg.MetricsInterval)
+	}
+	if pm.metricsInterval == 0 {
+		pm.metricsInterval = defaultMetricsInterval
+	}
+	if cfg.TailLines < 0 {
+		return nil, fmt.Errorf("invalid tail lines %d, expected a positive number", cfg.TailLines)
+	}
+	if pm.output.tailLines == 0 {
+		pm.output.tailLines = defaultTailLines
+	}
+
+	if cfg.OrderedOutput {
+		pm.output.orderWindow = orderedOutputWindow
+	}
+
+	if cfg.LogDir != "" {
+		logDir := cfg.LogDir
+		if !filepath.IsAbs(logDir) {
+			logDir = filepath.Join(root, logDir)
+		}
+		if pm.output.logger, err = newFileLogger(logDir, cfg.LogFormat); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ExitCodeFile != "" {
+		pm.exitPath = cfg.ExitCodeFile
+		if !filepath.IsAbs(pm.exitPath) {
+			pm.exitPath = filepath.Join(root, pm.exitPath)
+		}
+	}
+
+	if !cfg.NoLockFile {
+		pm.lockPath = cfg.LockFilePath
+		if pm.lockPath == "" {
+			pm.lockPath = lockFileName
+		}
+		if !filepath.IsAbs(pm.lockPath) {
+			pm.lockPath = filepath.Join(root, pm.lockPath)
+		}
+	}
+
+	if cfg.ControlSocket != "" {
+		pm.controlPath = cfg.ControlSocket
+		if !filepath.IsAbs(pm.controlPath) {
+			pm.controlPath = filepath.Join(root, pm.controlPath)
+		}
+	}
+
+	palette, err := colorPalette(cfg.Colors, pm.output)
+	if err != nil {
+		return nil, err
+	}
+	pm.cfg, pm.palette = cfg, palette
+
+	env := os.Environ()
+	if cfg.NoInheritEnv {
+		env = nil
+		if path, ok := os.LookupEnv("PATH"); ok {
+			env = []string{"PATH=" + path}
+		}
+	}
+	if cfg.UseNvm {
+		nvmBin, err := findNvmBin(root)
+		if err != nil {
+			pm.warnf("%v", err)
+		} else if nvmBin != "" {
+			injectPathVal(env, nvmBin)
+		}
+	}
+	if cfg.InjectPackageVersion {
+		// This is the same package.json npm scripts are read from, so it's
+		// found before parsing commands, for on-exit commands to see too.
+		pkgPath, _ := findPackageJSON(root, !cfg.NoPackageJSONWalk)
+		if version := packageVersion(pkgPath); version != "" {
+			env = append(env, "APP_VERSION="+version)
+		}
+	}
+	pm.root, pm.env = root, env
+	pm.shell = cfg.Shell
+	if pm.shell == "" {
+		pm.shell = defaultShell
+	}
+	pm.onAllExit = cfg.OnAllExit
+	pm.onFirstExit = cfg.OnFirstExit
+	procs, pkgPath, err := pm.newProcesses(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pkgPath != "" && filepath.Dir(pkgPath) != root && !pm.silent {
+		fmt.Fprintln(pm.output.writer(), ansi.Dim("Using scripts from "+pkgPath))
+	}
+	for _, proc := range procs {
+		pm.output.Connect(proc)
+	}
+	pm.procs = procs
+	if cfg.StdinProcess != "" {
+		for _, proc := range pm.procs {
+			if proc.Name == cfg.StdinProcess {
+				pm.stdinProc = proc
+			}
+		}
+		if pm.stdinProc == nil {
+			return nil, configErrorf(ErrKindUnknownProcess, "no process named %q to forward stdin to", cfg.StdinProcess)
+		}
+		pm.stdinEcho = cfg.PrependNameToStdin
+	}
+	if cfg.StdinBroadcast {
+		if cfg.StdinProcess != "" {
+			return nil, fmt.Errorf("StdinProcess and StdinBroadcast can't be used together")
+		}
+		pm.stdinBroadcast = true
+		pm.stdinEcho = cfg.PrependNameToStdin
+	}
+	return pm, nil
+}
+
+// newProcesses creates the processes for the commands in cfg, using the
+// settings the process manager was created with, like its root and
+// environment. It has no side effects, so it's also used to compare a
+// reloaded config against the running processes, and for piped commands.
+// Processes need connecting to the output before they're run. It also returns
+// the package.json that npm scripts were read from, if any.
+func (pm *ProcessManager) newProcesses(cfg Config) ([]*process, string, error) {
+	root, env := pm.root, pm.env
+	killSignal, err := ParseKillSignal(cfg.KillSignal)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid kill signal: %v", err)
+	}
+	interruptSignal, err := ParseInterruptSignal(cfg.InterruptSignal)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid interrupt signal: %v", err)
+	}
+	var nodeBinPaths []string
+	for _, p := range cfg.NodeBinPaths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		nodeBinPaths = append(nodeBinPaths, p)
+	}
+
+	var procs []*process
+	var namedCmds []command
+	for _, pc := range cfg.Processes {
+		cmd, err := pc.command()
+		if err != nil {
+			return nil, "", err
+		}
+		if cfg.NameFromDir && !cmd.explicit && pc.Dir != "" {
+			cmd.name = filepath.Base(filepath.Clean(pc.Dir))
+		}
+		namedCmds = append(namedCmds, cmd)
+	}
+	opts := parseOptions{
+		npxArgs:           cfg.NpxArgs,
+		bunArgs:           cfg.BunArgs,
+		noPackageJSONWalk: cfg.NoPackageJSONWalk,
+		exec:              cfg.Exec,
+
+		skipMissingWorkspaceScripts: cfg.SkipMissingWorkspaceScripts,
+		warn:                        pm.output,
+	}
+	if cfg.OnlyNamed && len(cfg.AllowedScripts) > 0 {
+		opts.allowedScripts = cfg.AllowedScripts
+	}
+	if opts.ignoredScripts, err = loadIgnoreFile(root, cfg.IgnoreFile); err != nil {
+		return nil, "", err
+	}
+	parsedCmds, pkgPath, err := parseCommands(root, cfg.Cmds, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	namedCmds = append(namedCmds, parsedCmds...)
+	namedCmds, err = uniqueNames(namedCmds)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(cfg.Exclude) > 0 {
+		excluded := make(map[string]bool, len(cfg.Exclude))
+		for _, name := range cfg.Exclude {
+			excluded[name] = true
+		}
+		kept := namedCmds[:0]
+		for _, cmd := range namedCmds {
+			if excluded[cmd.name] {
+				delete(excluded, cmd.name)
+				continue
+			}
+			kept = append(kept, cmd)
+		}
+		namedCmds = kept
+		for name := range excluded {
+			return nil, "", configErrorf(ErrKindUnknownProcess, "can't exclude unknown process %q", name)
+		}
+	}
+	if cfg.SortByName {
+		sort.SliceStable(namedCmds, func(i, j int) bool {
+			return namedCmds[i].name < namedCmds[j].name
+		})
+	}
+	if cfg.BasePort < 0 || cfg.BasePort+len(namedCmds) > 65536 {
+		return nil, "", fmt.Errorf("invalid base port %d for %d processes", cfg.BasePort, len(namedCmds))
+	}
+
+	ports, err := checkPorts(cfg.Ports)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, code := range cfg.IgnoreExitCodes {
+		if code < 0 || code > 255 {
+			return nil, "", fmt.Errorf("invalid exit code %d to ignore, expected a number from 0 to 255", code)
+		}
+	}
+
+	dirs := make(map[string]string, len(cfg.Dirs))
+	for name, dir := range cfg.Dirs {
+		if dir == "" {
+			return nil, "", fmt.Errorf("empty directory for %q", name)
+		}
+		dirs[name] = dir
+	}
+
+	users := make(map[string]string, len(cfg.Users))
+	for name, u := range cfg.Users {
+		if u == "" {
+			return nil, "", fmt.Errorf("empty user for %q", name)
+		}
+		users[name] = u
+	}
+
+	readyStrings := make(map[string]string, len(cfg.ReadyStrings))
+	for name, s := range cfg.ReadyStrings {
+		if s == "" {
+			return nil, "", fmt.Errorf("empty ready string for %q", name)
+		}
+		readyStrings[name] = s
+	}
+
+	readyPorts := make(map[string]int, len(cfg.ReadyPorts))
+	for name, port := range cfg.ReadyPorts {
+		if port < 1 || port > 65535 {
+			return nil, "", fmt.Errorf("invalid ready port %d for %q", port, name)
+		}
+		readyPorts[name] = port
+	}
+
+	// Groups are given by name, but stored on each process.
+	groupNames := make([]string, 0, len(cfg.Groups))
+	for group := range cfg.Groups {
+		groupNames = append(groupNames, group)
+	}
+	sort.Strings(groupNames)
+	procGroups := make(map[string][]string)
+	for _, group := range groupNames {
+		for _, name := range cfg.Groups[group] {
+			procGroups[name] = append(procGroups[name], group)
+		}
+	}
+
+	timeouts := make(map[string]time.Duration, len(cfg.Timeouts))
+	for name, t := range cfg.Timeouts {
+		timeouts[name] = time.Duration(t) * time.Second
+	}
+
+	for i, cmd := range namedCmds {
+		timeout, ok := timeouts[cmd.name]
+		if !ok {
+			timeout = pm.timeout
+		}
+		delete(timeouts, cmd.name)
+		if d, ok := dirs[cmd.name]; ok {
+			cmd.dir = d
+			delete(dirs, cmd.name)
+		}
+		dir := root
+		if cmd.dir != "" {
+			dir = cmd.dir
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+		}
+		color := pm.palette[i%len(pm.palette)]
+		if cfg.ColorByHash {
+			color = colorForName(cmd.name, pm.palette)
+		}
+		if cmd.customColor {
+			color = cmd.color
+		}
+		if u, ok := users[cmd.name]; ok {
+			cmd.user = u
+			delete(users, cmd.name)
+		}
+		var cred *syscall.Credential
+		if cmd.user != "" {
+			if cred, err = pm.credential(cmd.user); err != nil {
+				return nil, "", err
+			}
+		}
+		procEnv := make([]string, 0, len(env)+len(cmd.env))
+		procEnv = append(append(procEnv, env...), cmd.env...)
+		if port, ok := ports[cmd.name]; ok {
+			procEnv = append(procEnv, fmt.Sprintf("PORT=%d", port))
+			delete(ports, cmd.name)
+		} else if cfg.BasePort > 0 {
+			procEnv = append(procEnv, fmt.Sprintf("PORT=%d", cfg.BasePort+i))
+		}
+		if !cfg.DisableNodeBin {
+			bins := nodeBinPaths
+			if bins == nil {
+				bins = findNodeBins(dir, root)
+			}
+			if len(bins) > 0 {
+				procEnv = injectPathVal(procEnv, strings.Join(bins, string(filepath.ListSeparator)))
+			}
+		}
+		killSig := killSignal
+		if cmd.killSignal != "" {
+			if killSig, err = ParseKillSignal(cmd.killSignal); err != nil {
+				return nil, "", fmt.Errorf("invalid kill signal for %q: %v", cmd.name, err)
+			}
+		}
+		intSig := interruptSignal
+		if cmd.interruptSignal != "" {
+			if intSig, err = ParseInterruptSignal(cmd.interruptSignal); err != nil {
+				return nil, "", fmt.Errorf("invalid interrupt signal for %q: %v", cmd.name, err)
+			}
+		}
+		maxRestarts := pm.maxRestarts
+		if cmd.maxRestarts > 0 {
+			maxRestarts = cmd.maxRestarts
+		}
+		delay := restartDelay
+		if cmd.restartDelay > 0 {
+			delay = cmd.restartDelay
+		}
+		if cfg.RaceDetect {
+			cmd.cmd = addRaceFlag(cmd.cmd)
+		}
+		readyString := readyStrings[cmd.name]
+		delete(readyStrings, cmd.name)
+		readyPort := readyPorts[cmd.name]
+		delete(readyPorts, cmd.name)
+		groups := append(append([]string(nil), cmd.groups...), procGroups[cmd.name]...)
+		delete(procGroups, cmd.name)
+		watchGlobs := make([]string, len(cmd.watchGlobs))
+		for i, glob := range cmd.watchGlobs {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return nil, "", fmt.Errorf("invalid watch pattern %q for %q: %v", glob, cmd.name, err)
+			}
+			if !filepath.IsAbs(glob) {
+				glob = filepath.Join(dir, glob)
+			}
+			watchGlobs[i] = glob
+		}
+		var args []string
+		if cfg.Exec {
+			if args, err = splitArgs(cmd.cmd); err != nil {
+				return nil, "", fmt.Errorf("invalid command for %q: %v", cmd.name, err)
+			}
+		}
+		procs = append(procs, newProcess(&processConfig{
+			Name:            cmd.name,
+			Cmd:             cmd.cmd,
+			Args:            args,
+			Shell:           pm.shell,
+			Color:           color,
+			Dir:             dir,
+			Env:             procEnv,
+			Output:          pm.output,
+			Silent:          pm.silent || cmd.silent,
+			PreStartHook:    cfg.PreStartHook,
+			PostExitHook:    cfg.PostExitHook,
+			Timeout:         timeout,
+			Restart:         cmd.restart,
+			KillSignal:      killSig,
+			InterruptSignal: intSig,
+			MaxRestarts:     maxRestarts,
+			RestartDelay:    delay,
+			ReadyString:     readyString,
+			ReadyPort:       readyPort,
+			Groups:          groups,
+			Description:     cmd.description,
+			User:            cmd.user,
+			Credential:      cred,
+			IgnoreExitCodes: cfg.IgnoreExitCodes,
+			StartTimeout:    cfg.StartTimeout,
+			StartKill:       cfg.StartTimeoutKill,
+			Messages:        cfg.ShutdownMessages,
+			Socket:          cmd.socket,
+			CustomColor:     cmd.customColor,
+			WatchGlobs:      watchGlobs,
+			WaitFor:         cmd.waitFor,
+		}))
+	}
+	for name := range timeouts {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "timeout given for unknown process %q", name)
+	}
+	for name := range ports {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "port given for unknown process %q", name)
+	}
+	for name := range dirs {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "directory given for unknown process %q", name)
+	}
+	for name := range users {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "user given for unknown process %q", name)
+	}
+	for name := range readyStrings {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "ready string given for unknown process %q", name)
+	}
+	for name := range readyPorts {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "ready port given for unknown process %q", name)
+	}
+	for name := range procGroups {
+		return nil, "", configErrorf(ErrKindUnknownProcess, "group given for unknown process %q", name)
+	}
+	if err := checkWaitFor(procs); err != nil {
+		return nil, "", err
+	}
+	return procs, pkgPath, nil
+}
+
+// credential returns the credential to run processes as the given user,
+// looking each user up only once.
+func (pm *ProcessManager) credential(user string) (*syscall.Credential, error) {
+	pm.credsMu.Lock()
+	defer pm.credsMu.Unlock()
+	if cred, ok := pm.creds[user]; ok {
+		return cred, nil
+	}
+	cred, err := lookupCredential(user)
+	if err != nil {
+		return nil, err
+	}
+	if pm.creds == nil {
+		pm.creds = make(map[string]*syscall.Credential)
+	}
+	pm.creds[user] = cred
+	return cred, nil
+}
+
+// MustNew is like New but panics if the configuration is invalid. It
+// simplifies setting up a process manager with a static configuration.
+func MustNew(cfg Config) *ProcessManager {
+	pm, err := New(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("tandem: invalid config: %v", err))
+	}
+	return pm
+}
+
+// processes returns the processes being managed. Piped commands can add
+// processes while running, so this is used rather than reading procs once
+// running.
+func (pm *ProcessManager) processes() []*process {
+	pm.procsMu.RLock()
+	defer pm.procsMu.RUnlock()
+	return pm.procs[:len(pm.procs):len(pm.procs)]
+}
+
+// Len returns the number of processes managed by the process manager.
+func (pm *ProcessManager) Len() int {
+	return len(pm.processes())
+}
+
+// Names returns the display names of each process, in order.
+func (pm *ProcessManager) Names() []string {
+	procs := pm.processes()
+	names := make([]string, len(procs))
+	for i, proc := range procs {
+		names[i] = proc.Name
+	}
+	return names
+}
+
+// Ready returns a channel that's closed once the named process is ready,
+// which is the first time its output contains its ready string or its ready
+// port accepts connections. It's never closed for processes without either.
+// Once a process is ready, it stays ready even if it's restarted.
+func (pm *ProcessManager) Ready(name string) (<-chan struct{}, error) {
+	proc, err := pm.process(name)
+	if err != nil {
+		return nil, err
+	}
+	return proc.ready, nil
+}
+
+// WaitForReady blocks until every process has written at least one line of
+// output itself, not counting tandem's messages about it, or ctx is done, in
+// which case it returns ctx's error. Processes that exit without writing
+// anything are waited on until ctx is done.
+func (pm *ProcessManager) WaitForReady(ctx context.Context) error {
+	for _, proc := range pm.processes() {
+		select {
+		case <-proc.firstOutput:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// ExitCode returns the exit code of the named process's last run, or -1 if
+// it hasn't exited yet.
+func (pm *ProcessManager) ExitCode(name string) (int, error) {
+	proc, err := pm.process(name)
+	if err != nil {
+		return 0, err
+	}
+	return proc.ExitCode(), nil
+}
+
+// SignalGroup sends a signal to each running process in the given group.
+func (pm *ProcessManager) SignalGroup(group string, sig os.Signal) error {
+	found := false
+	for _, proc := range pm.processes() {
+		if !slices.Contains(proc.groups, group) {
+			continue
+		}
+		found = true
+		if proc.Running() {
+			if !proc.silent {
+				proc.writeDebug(fmt.Sprintf("Sending %v...", sig))
+			}
+			proc.signal(sig)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no processes in group %q", group)
+	}
+	return nil
+}
+
+// Pause stops the named process with SIGSTOP until it's resumed, for example
+// to quiet one that's flooding the output.
+func (pm *ProcessManager) Pause(name string) error {
+	proc, err := pm.runningProcess(name)
+	if err != nil {
+		return err
+	}
+	proc.Pause()
+	return nil
+}
+
+// Resume continues the named process with SIGCONT after it's been paused.
+func (pm *ProcessManager) Resume(name string) error {
+	proc, err := pm.runningProcess(name)
+	if err != nil {
+		return err
+	}
+	proc.Resume()
+	return nil
+}
+
+// Attach writes the last n lines of the named process's output to w, then
+// each line it writes from then on, until detach is called or writing to w
+// fails. Lines are written in full, with any ANSI codes, and without the
+// process's label. At most TailLines lines are kept to be replayed.
+//
+// Lines are written to w from its own goroutine, so a slow writer doesn't
+// hold up other output. If w falls too far behind, it's detached and sees no
+// more lines. The control socket's TAIL command serves this to clients.
+func (pm *ProcessManager) Attach(name string, n int, w io.Writer) (detach func(), err error) {
+	proc, err := pm.process(name)
+	if err != nil {
+		return nil, err
+	}
+	return pm.output.Attach(proc, n, w), nil
+}
+
+// Reload applies cfg to the running processes. Processes whose command,
+// directory or environment changed are restarted with the new settings, and
+// the rest keep running untouched. New processes are started, and processes
+// no longer in cfg are stopped. Only settings for processes are reloaded;
+// the rest of cfg, like Root or Timeout, is ignored. If cfg can't be applied,
+// an error is returned and the running processes are left as they are.
+func (pm *ProcessManager) Reload(cfg Config) error {
+	procs, _, err := pm.newProcesses(cfg)
+	if err != nil {
+		return err
+	}
+	changed, removed, err := pm.applyReload(procs)
+	if err != nil {
+		return err
+	}
+	// Processes are signalled once procsMu is released, so they don't hold
+	// up anything looking up processes in the meantime.
+	for _, proc := range changed {
+		proc.Restart("Config changed, restarting...")
+	}
+	for _, proc := range removed {
+		if !proc.Running() {
+			continue
+		}
+		if !proc.silent {
+			proc.writeDebug("Removed from config, stopping...")
+		}
+		proc.Interrupt()
+		go pm.killAfterTimeout(proc, nil)
+	}
+	return nil
+}
+
+// applyReload replaces the processes being managed with procs, keeping the
+// existing process for each name that's still there. It returns the kept
+// processes whose command changed and the processes that were removed, which
+// the caller restarts and stops. Nothing is changed if it returns an error.
+func (pm *ProcessManager) applyReload(procs []*process) (changed, removed []*process, err error) {
+	pm.procsMu.Lock()
+	defer pm.procsMu.Unlock()
+	if pm.running && pm.shuttingDown() {
+		return nil, nil, errors.New("can't reload while shutting down")
+	}
+	names := make(map[string]bool, len(procs))
+	for _, np := range procs {
+		names[np.Name] = true
+		if pm.findProcess(np.Name) == nil && !pm.canAddProcess() {
+			return nil, nil, fmt.Errorf("can't add process %q while shutting down", np.Name)
+		}
+	}
+
+	var added []*process
+	for _, np := range procs {
+		proc := pm.findProcess(np.Name)
+		if proc == nil {
+			added = append(added, np)
+			continue
+		}
+		if proc.update(np.Cmd, np.command) {
+			changed = append(changed, proc)
+		}
+	}
+	kept := make([]*process, 0, len(pm.procs))
+	for _, proc := range pm.procs {
+		if names[proc.Name] {
+			kept = append(kept, proc)
+			continue
+		}
+		proc.remove()
+		removed = append(removed, proc)
+	}
+	// Snapshots from processes share the old slice, so it's replaced
+	// rather than changed in place.
+	pm.procs = kept
+	for _, proc := range added {
+		pm.addProcess(proc)
+	}
+	return changed, removed, nil
+}
+
+// canAddProcess reports whether processes can be added, which they can't
+// once tandem is shutting down. The caller must hold procsMu.
+func (pm *ProcessManager) canAddProcess() bool {
+	return !pm.running || !(pm.pipeClosed || pm.shuttingDown())
+}
+
+// addProcess adds a process while running, starting it unless run hasn't
+// started processes yet, in which case it's started along with the rest. It
+// returns false if processes can't be added anymore, since tandem is shutting
+// down. The caller must hold procsMu.
+func (pm *ProcessManager) addProcess(proc *process) bool {
+	if !pm.canAddProcess() {
+		return false
+	}
+	pm.output.Connect(proc)
+	pm.procs = append(pm.procs, proc)
+	if pm.running {
+		pm.runProcess(proc)
+	}
+	return true
+}
+
+// findProcess returns the process with the given name, or nil if there isn't
+// one. The caller must hold procsMu.
+func (pm *ProcessManager) findProcess(name string) *process {
+	for _, proc := range pm.procs {
+		if proc.Name == name {
+			return proc
+		}
+	}
+	return nil
+}
+
+// process returns the process with the given name.
+func (pm *ProcessManager) process(name string) (*process, error) {
+	for _, proc := range pm.processes() {
+		if proc.Name == name {
+			return proc, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrProcessNotFound, name)
+}
+
+func (pm *ProcessManager) runningProcess(name string) (*process, error) {
+	proc, err := pm.process(name)
+	if err != nil {
+		return nil, err
+	}
+	if !proc.Running() {
+		return nil, fmt.Errorf("process %q isn't running", name)
+	}
+	return proc, nil
+}
+
+// DryRun prints the name and command of each process, labelled the same way
+// as output would be, without running anything. Descriptions are shown dimmed
+// after the command.
+func (pm *ProcessManager) DryRun() {
+	if pm.shell != defaultShell {
+		fmt.Fprintln(pm.output.writer(), ansi.Dim("Using shell "+pm.shell))
+	}
+	for _, proc := range pm.processes() {
+		line := proc.command
+		if proc.description != "" {
+			line += "  " + ansi.Dim("# "+proc.description)
+		}
+		proc.writeLine([]byte(line))
+	}
+	pm.output.Flush()
+}
+
+// ProcessResult describes a process after it has run.
+type ProcessResult struct {
+	Name         string // Display name of the process
+	ExitCode     int    // Exit code of the last run, or -1 if it didn't run or was killed
+	LinesWritten int64  // Number of lines of output produced
+	BytesWritten int64  // Number of bytes of output produced, excluding newlines
+	Restarts     int    // Number of times the process was restarted
+}
+
+// Results returns the result of each process, in order. It's meant to be
+// called after Run returns.
+func (pm *ProcessManager) Results() []ProcessResult {
+	procs := pm.processes()
+	results := make([]ProcessResult, len(procs))
+	for i, proc := range procs {
+		lines, bytes := pm.output.Stats(proc)
+		results[i] = ProcessResult{
+			Name:         proc.Name,
+			ExitCode:     proc.ExitCode(),
+			LinesWritten: lines,
+			BytesWritten: bytes,
+			Restarts:     proc.restartCount(),
+		}
+	}
+	return results
+}
+
+// Run starts all processes and waits for them to exit or be interrupted.
+func (pm *ProcessManager) Run() {
+	pm.run(context.Background())
+}
+
+// RunPipe runs the process manager like Run, but also starts each command read
+// from r as a new process as soon as it's read, one per line. Blank lines and
+// lines starting with '#' are skipped. A process exiting doesn't stop the
+// others, and reaching the end of r doesn't stop processes already running:
+// it returns once r is exhausted and every process has exited, or once tandem
+// is interrupted.
+func (pm *ProcessManager) RunPipe(r io.Reader) {
+	pm.pipe = r
+	pm.run(context.Background())
+}
+
+// RunOnce runs only the named process, waiting for it to exit, and returns an
+// error if it fails. It's useful for running a setup step, like a database
+// migration, before calling Run to start everything.
+func (pm *ProcessManager) RunOnce(name string) error {
+	return pm.RunOnceContext(context.Background(), name)
+}
+
+// RunOnceContext is like RunOnce, but interrupts the process if ctx is
+// cancelled, killing it if it hasn't exited by the end of its timeout.
+func (pm *ProcessManager) RunOnceContext(ctx context.Context, name string) error {
+	proc, err := pm.process(name)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// A command can only be run once, so reset the process if it's been run.
+	if pid, _ := proc.proc(); pid != 0 {
+		proc.reset()
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		proc.Interrupt()
+		select {
+		case <-done:
+		case <-time.After(proc.timeout):
+			proc.Kill()
+		}
+	}()
+	proc.Run()
+	close(done)
+	<-stopped
+	return proc.exitErr()
+}
+
+// RunAll runs a process manager for each of the given configs at once, and
+// waits for all of their processes to exit. Each group of processes shuts down
+// independently, so a process exiting only stops the others in its group.
+// Cancelling ctx shuts down every group. The returned error describes each
+// group whose processes stopped because one of them failed.
+func RunAll(ctx context.Context, cfgs []Config) error {
+	pms := make([]*ProcessManager, len(cfgs))
+	for i, cfg := range cfgs {
+		pm, err := New(cfg)
+		if err != nil {
+			return fmt.Errorf("group %d: %v", i+1, err)
+		}
+		pms[i] = pm
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(pms))
+	for i, pm := range pms {
+		wg.Add(1)
+		go func(i int, pm *ProcessManager) {
+			defer wg.Done()
+			pm.run(ctx)
+			if err := pm.exitErr(); err != nil {
+				errs[i] = fmt.Errorf("group %d: %v", i+1, err)
+			}
+		}(i, pm)
+	}
+	wg.Wait()
+
+	var msgs []string
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
 }
 
-// Config is the configuration for a process manager.
-type Config struct {
-	Cmds    []string // Shell commands to run
-	Root    string   // Root directory for commands to run from
-	Timeout int      // Timeout in seconds for commands to exit gracefully before being killed. Defaults to 0.
-	Silent  bool     // Whether to silence process management messages like "Starting..."
+// exitErr returns an error if the process that caused the process manager to
+// shut down failed.
+func (pm *ProcessManager) exitErr() error {
+	pm.exitMu.Lock()
+	proc := pm.firstExit
+	pm.exitMu.Unlock()
+	if proc == nil {
+		return nil
+	}
+	return proc.exitErr()
 }
 
-// New creates a new process manager with the given configuration.
-func New(cfg Config) (*ProcessManager, error) {
-	root, err := filepath.Abs(cfg.Root)
-	if err != nil {
-		return nil, fmt.Errorf("could not get absolute path for directory: %v", err)
+// exitCode returns the exit code for the run as a whole: the exit code of the
+// process that caused shutdown if it failed, 128 plus the signal number if
+// tandem was interrupted, or 0.
+func (pm *ProcessManager) exitCode() int {
+	pm.exitMu.Lock()
+	proc, sig := pm.firstExit, pm.exitSignal
+	pm.exitMu.Unlock()
+	if proc != nil && !proc.exitedCleanly() {
+		if code := proc.ExitCode(); code > 0 {
+			return code
+		}
+		return 1
 	}
-
-	pm := &ProcessManager{
-		output:  &multiOutput{printProcName: true},
-		procs:   make([]*process, 0),
-		timeout: time.Duration(cfg.Timeout) * time.Second,
-		silent:  cfg.Silent,
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
 	}
+	return 0
+}
 
-	env := os.Environ()
-	nodeBin := filepath.Join(cfg.Root, "node_modules/.bin")
-	if fi, err := os.Stat(nodeBin); err == nil && fi.IsDir() {
-		injectPathVal(env, nodeBin)
-	}
+// RunExitCode returns the exit code for the run as a whole, which is also
+// what's written to the exit code file: the exit code of the process that
+// caused shutdown if it failed, 128 plus the signal number if tandem was
+// interrupted, or 0. It's meant to be called after Run returns.
+func (pm *ProcessManager) RunExitCode() int {
+	return pm.exitCode()
+}
 
-	namedCmds, err := parseCommands(root, cfg.Cmds)
-	if err != nil {
-		return nil, err
+// warnf writes a warning to the output, so it's shown alongside process
+// output rather than on stderr.
+func (pm *ProcessManager) warnf(format string, args ...interface{}) {
+	fmt.Fprintf(pm.output, "tandem: warning: "+format+"\n", args...)
+}
+
+// Warnf writes a warning to the output like warnings from tandem itself, for
+// callers reporting problems alongside process output.
+func (pm *ProcessManager) Warnf(format string, args ...interface{}) {
+	pm.warnf(format, args...)
+}
+
+// writeExitCode writes the exit code for the run to the exit code file.
+func (pm *ProcessManager) writeExitCode() {
+	code := strconv.Itoa(pm.exitCode()) + "\n"
+	if err := os.WriteFile(pm.exitPath, []byte(code), 0o644); err != nil {
+		pm.warnf("writing exit code file: %v", err)
 	}
+}
 
-	for i, cmd := range namedCmds {
-		pm.procs = append(pm.procs, newProcess(&processConfig{
-			Name:   cmd.name,
-			Cmd:    cmd.cmd,
-			Color:  colors[i%len(colors)],
-			Dir:    root,
-			Env:    env,
-			Output: pm.output,
-			Silent: pm.silent,
-		}))
+// recordExit records proc as the process that caused shutdown, if it exited
+// on its own before anything else.
+func (pm *ProcessManager) recordExit(proc *process) {
+	pm.exitMu.Lock()
+	defer pm.exitMu.Unlock()
+	if pm.firstExit == nil && !pm.shuttingDown() {
+		pm.firstExit = proc
+		if pm.onFirstExit != "" {
+			pm.exitCmdWg.Add(1)
+			go func() {
+				defer pm.exitCmdWg.Done()
+				pm.runExitCmd("on-first-exit", pm.onFirstExit, []string{
+					"TANDEM_PROC_NAME=" + proc.Name,
+					fmt.Sprintf("TANDEM_EXIT_CODE=%d", proc.ExitCode()),
+				})
+			}()
+		}
 	}
-	return pm, nil
 }
 
-// Run starts all processes and waits for them to exit or be interrupted.
-func (pm *ProcessManager) Run() {
-	pm.done = make(chan bool, len(pm.procs))
+func (pm *ProcessManager) run(ctx context.Context) {
+	pm.done = make(chan *process, len(pm.procs))
+	pm.stop = ctx.Done()
 	pm.interrupted = make(chan os.Signal)
+	pm.shutdown = make(chan struct{})
+	pm.shutdownOnce = new(sync.Once)
+	pm.finished = make(chan struct{})
 	signal.Notify(pm.interrupted, syscall.SIGINT, syscall.SIGTERM)
-	for _, proc := range pm.procs {
+	defer signal.Stop(pm.interrupted)
+	if pm.output.logger != nil {
+		if err := pm.output.logger.Open(); err != nil {
+			pm.warnf("%v", err)
+		}
+		defer pm.output.logger.Close()
+	}
+	if pm.lockPath != "" {
+		if err := writeLockFile(pm.lockPath, pm.Names(), pm.output); err != nil {
+			pm.warnf("writing lock file: %v", err)
+		} else {
+			defer removeLockFile(pm.lockPath)
+		}
+	}
+	if pm.controlPath != "" {
+		if ln, err := listenControl(pm.controlPath, pm.output); err != nil {
+			pm.warnf("listening on control socket: %v", err)
+		} else {
+			defer ln.Close()
+			stop := make(chan struct{})
+			defer close(stop)
+			go pm.serveControl(ln, stop)
+		}
+	}
+	// Processes added from here on by Reload are started as they're added.
+	pm.procsMu.Lock()
+	pm.running = true
+	procs := pm.procs[:len(pm.procs):len(pm.procs)]
+	pm.procsMu.Unlock()
+	if !pm.silent && !pm.noBanner && len(procs) > 0 {
+		pm.output.WriteBanner(procs)
+	}
+	for _, proc := range procs {
+		// Processes may have been run already by RunOnce.
+		if pid, _ := proc.proc(); pid != 0 {
+			proc.reset()
+		}
 		pm.runProcess(proc)
 	}
+	if pm.watchdogTimeout > 0 {
+		go pm.watchdog()
+	}
+	go pm.watchFiles()
+	var stopHeartbeat chan struct{}
+	if pm.heartbeatInterval > 0 {
+		stopHeartbeat = make(chan struct{})
+		go pm.heartbeat(stopHeartbeat)
+	}
+	if pm.metricsAddr != "" {
+		if ln, err := net.Listen("tcp", pm.metricsAddr); err != nil {
+			pm.warnf("serving metrics: %v", err)
+		} else {
+			defer ln.Close()
+			stop := make(chan struct{})
+			defer close(stop)
+			go pm.sampleMetrics(pm.metricsInterval, stop)
+			go pm.serveMetrics(ln)
+		}
+	}
+	if pm.stdinProc != nil || pm.stdinBroadcast {
+		go pm.forwardStdin()
+	}
+	if len(pm.passthroughSignals) > 0 {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, pm.passthroughSignals...)
+		defer signal.Stop(sigs)
+		stop := make(chan struct{})
+		defer close(stop)
+		go pm.forwardSignals(sigs, stop)
+	}
 	go pm.waitForExit()
+	if pm.pipe != nil {
+		// Piped commands can't be added once procWg is being waited on, so
+		// stop reading them first.
+		eof := make(chan struct{})
+		go pm.readPipe(eof)
+		select {
+		case <-eof:
+		case <-pm.shutdown:
+		}
+		pm.procsMu.Lock()
+		pm.pipeClosed = true
+		pm.procsMu.Unlock()
+	}
 	pm.procWg.Wait()
+	if pm.pipe != nil {
+		close(pm.finished)
+	}
+	if stopHeartbeat != nil {
+		close(stopHeartbeat)
+	}
+	if pm.noAutoExit {
+		<-pm.shutdown
+	}
+	pm.output.Flush()
+	pm.exitCmdWg.Wait()
+	if pm.onAllExit != "" {
+		pm.runExitCmd("on-all-exit", pm.onAllExit, nil)
+	}
+	if pm.exitPath != "" {
+		pm.writeExitCode()
+	}
+}
+
+// readPipe starts a process for each command read from pm.pipe, closing eof
+// once there are no more.
+func (pm *ProcessManager) readPipe(eof chan<- struct{}) {
+	defer close(eof)
+	scanner := bufio.NewScanner(pm.pipe)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := pm.startPiped(line); err != nil {
+			pm.warnf("skipping piped command %q: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		pm.warnf("reading piped commands: %v", err)
+	}
+}
+
+// startPiped creates and starts processes for a piped command, with the same
+// settings as those given on start. Settings for individual processes by name
+// don't apply to piped commands.
+func (pm *ProcessManager) startPiped(line string) error {
+	cfg := pm.cfg
+	cfg.Cmds = []string{line}
+	cfg.Processes = nil
+	cfg.Timeouts, cfg.Ports, cfg.ReadyPorts, cfg.ReadyStrings = nil, nil, nil, nil
+	cfg.Users, cfg.Dirs, cfg.Groups, cfg.Exclude = nil, nil, nil, nil
+	cfg.BasePort = 0
+	procs, _, err := pm.newProcesses(cfg)
+	if err != nil {
+		return err
+	}
+
+	pm.procsMu.Lock()
+	defer pm.procsMu.Unlock()
+	for _, proc := range procs {
+		proc.Name = pm.unusedName(proc.Name)
+		if !proc.customColor {
+			proc.Color = pm.palette[len(pm.procs)%len(pm.palette)]
+			if cfg.ColorByHash {
+				proc.Color = colorForName(proc.Name, pm.palette)
+			}
+		}
+		if !pm.addProcess(proc) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// unusedName returns name, or name with a number added if a process already
+// has it. The caller must hold procsMu.
+func (pm *ProcessManager) unusedName(name string) string {
+	if pm.findProcess(name) == nil {
+		return name
+	}
+	for i := 2; ; i++ {
+		if n := fmt.Sprintf("%s.%d", name, i); pm.findProcess(n) == nil {
+			return n
+		}
+	}
+}
+
+// runExitCmd runs a shell command from the root once processes exit,
+// reporting if it fails. The name labels any error.
+func (pm *ProcessManager) runExitCmd(name, command string, env []string) {
+	cmd := exec.Command(pm.shell, "-c", command)
+	cmd.Dir = pm.root
+	cmd.Env = append(append([]string(nil), pm.env...), env...)
+	cmd.Stdout = pm.output
+	cmd.Stderr = pm.output
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(pm.output, "tandem: %s command failed: %v\n", name, err)
+	}
 }
 
 func (pm *ProcessManager) runProcess(proc *process) {
 	pm.procWg.Add(1)
 	go func() {
 		defer pm.procWg.Done()
-		defer func() { pm.done <- true }()
-		proc.Run()
+		defer func() {
+			// Processes removed by Reload were stopped on purpose, so
+			// don't cause a shutdown.
+			if proc.isRemoved() {
+				return
+			}
+			pm.recordExit(proc)
+			// Only the first exit is waited for, and piped commands can
+			// outnumber the buffer, so don't block on the rest.
+			select {
+			case pm.done <- proc:
+			default:
+			}
+		}()
+		if !pm.waitForDeps(proc) {
+			return
+		}
+		restarts := 0
+		var restartTimes []time.Time // Recent restarts, for the rate limit
+		for {
+			proc.Run()
+			if pm.shuttingDown() || proc.isRemoved() {
+				return
+			}
+			if proc.takeRestart() {
+				proc.countRestart()
+			} else {
+				if !pm.shouldRestart(proc, restarts) {
+					return
+				}
+				var ok bool
+				if restartTimes, ok = pm.allowRestart(restartTimes, time.Now()); !ok {
+					if !proc.silent {
+						proc.writeDebug(fmt.Sprintf("Restart rate limit exceeded (%d in %v), giving up", pm.maxWindowRestarts, pm.restartWindow))
+					}
+					return
+				}
+				restarts++
+				n := proc.countRestart()
+				if !proc.silent {
+					proc.writeDebug(fmt.Sprintf("Restarting... (restart %d)", n))
+				}
+				select {
+				case <-time.After(proc.restartDelay):
+				case <-pm.shutdown:
+					return
+				}
+				if proc.isRemoved() {
+					return
+				}
+			}
+			proc.reset()
+		}
 	}()
 }
 
+// shouldRestart reports whether a process that exited should be restarted,
+// given how many times it's been restarted already.
+func (pm *ProcessManager) shouldRestart(proc *process, restarts int) bool {
+	if proc.maxRestarts > 0 && restarts >= proc.maxRestarts {
+		return false
+	}
+	if proc.exitedCleanly() {
+		return pm.restartOnCleanExit
+	}
+	return pm.restartOnError || proc.restart
+}
+
+// allowRestart reports whether a process can be restarted at now without
+// going over the restart rate limit, given the times of its recent restarts.
+// It returns the recent restarts within the window, including this one if
+// it's allowed.
+func (pm *ProcessManager) allowRestart(times []time.Time, now time.Time) ([]time.Time, bool) {
+	if pm.restartWindow <= 0 {
+		return times, true
+	}
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < pm.restartWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= pm.maxWindowRestarts {
+		return recent, false
+	}
+	return append(recent, now), true
+}
+
+func (pm *ProcessManager) shuttingDown() bool {
+	select {
+	case <-pm.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// forwardSignals sends signals received on sigs to every running process,
+// until stop is closed.
+func (pm *ProcessManager) forwardSignals(sigs <-chan os.Signal, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case sig := <-sigs:
+			for _, proc := range pm.processes() {
+				if proc.Running() {
+					proc.signal(sig)
+				}
+			}
+		}
+	}
+}
+
+// forwardStdin copies input from stdin to the terminal of the stdin process,
+// or of every process if stdinBroadcast is set, until stdin is closed, at
+// which point they're sent an end-of-file. If stdinEcho is set, each complete
+// line is also written to the output with each process's prefix.
+func (pm *ProcessManager) forwardStdin() {
+	targets := []*process{pm.stdinProc}
+	if pm.stdinBroadcast {
+		targets = pm.processes()
+	}
+	pm.forwardInput(os.Stdin, targets)
+}
+
+// forwardInput copies input from r to the terminals of the target processes.
+func (pm *ProcessManager) forwardInput(r io.Reader, targets []*process) {
+	// Each process is written to from its own goroutine, so one that's slow
+	// to read its input doesn't hold up the others. Input for a process whose
+	// queue is full is dropped, and reported once until it catches up.
+	queues := make([]chan []byte, len(targets))
+	dropping := make([]bool, len(targets))
+	var wg sync.WaitGroup
+	for i, proc := range targets {
+		queues[i] = make(chan []byte, stdinQueueSize)
+		wg.Add(1)
+		go func(proc *process, queue <-chan []byte) {
+			defer wg.Done()
+			for p := range queue {
+				pm.output.WriteInput(proc, p)
+			}
+			pm.output.WriteInput(proc, []byte{4}) // Ctrl-D
+		}(proc, queues[i])
+	}
+	send := func(p []byte) {
+		for i, queue := range queues {
+			select {
+			case queue <- p:
+				dropping[i] = false
+			default:
+				if !dropping[i] {
+					dropping[i] = true
+					targets[i].writeErr(errors.New("dropping input, the process isn't reading it fast enough"))
+				}
+			}
+		}
+	}
+	echo := func(line []byte) {
+		for _, proc := range targets {
+			proc.writeLine(line)
+		}
+	}
+
+	buf := make([]byte, 4096)
+	var line []byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			send(append([]byte(nil), buf[:n]...))
+			if pm.stdinEcho {
+				line = append(line, buf[:n]...)
+				for {
+					i := bytes.IndexByte(line, '\n')
+					if i < 0 {
+						break
+					}
+					echo(bytes.TrimSuffix(line[:i], []byte{'\r'}))
+					line = line[i+1:]
+				}
+			}
+		}
+		if err != nil {
+			if len(line) > 0 {
+				echo(line)
+			}
+			for _, queue := range queues {
+				close(queue)
+			}
+			wg.Wait()
+			return
+		}
+	}
+}
+
+// watchdog periodically checks for processes that haven't produced output
+// within the watchdog timeout, and restarts them.
+func (pm *ProcessManager) watchdog() {
+	interval := pm.watchdogTimeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pm.shutdown:
+			return
+		case <-ticker.C:
+			for _, proc := range pm.processes() {
+				// Processes are interrupted on shutdown, so don't kill them
+				// out from under it.
+				if pm.shuttingDown() {
+					return
+				}
+				if proc.Running() && !proc.isPaused() && proc.idleFor() > pm.watchdogTimeout {
+					// Restart the idle clock too, so the process isn't
+					// restarted again before it's started back up.
+					proc.touch()
+					proc.Restart(fmt.Sprintf("No output for %v, restarting...", pm.watchdogTimeout))
+				}
+			}
+		}
+	}
+}
+
+// watchFiles restarts processes when files matching their watch globs are
+// added, removed or modified, checking every watchInterval until tandem shuts
+// down.
+func (pm *ProcessManager) watchFiles() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	seen := make(map[*process]map[string]fileStamp)
+	check := func() {
+		for _, proc := range pm.processes() {
+			if len(proc.watchGlobs) == 0 {
+				continue
+			}
+			files := globStamps(proc.watchGlobs)
+			prev, ok := seen[proc]
+			seen[proc] = files
+			if ok && !maps.Equal(prev, files) {
+				proc.Restart("Files changed, restarting...")
+			}
+		}
+	}
+	check()
+	for {
+		select {
+		case <-pm.shutdown:
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// fileStamp is what's compared to tell whether a watched file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// globStamps returns the stamp of each file matching the given patterns.
+func globStamps(globs []string) map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	for _, glob := range globs {
+		// Patterns are checked when the config is read, so this can't fail.
+		matches, _ := filepath.Glob(glob)
+		for _, path := range matches {
+			if fi, err := os.Stat(path); err == nil {
+				files[path] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+			}
+		}
+	}
+	return files
+}
+
+// waitForDeps blocks until each process proc waits for is ready, reporting
+// false if tandem starts shutting down first. Processes without a ready string
+// or ready port are ready once they first write output. Processes that have
+// since been removed by Reload aren't waited for.
+func (pm *ProcessManager) waitForDeps(proc *process) bool {
+	for _, name := range proc.waitFor {
+		dep, err := pm.process(name)
+		if err != nil {
+			continue
+		}
+		ready := dep.ready
+		if dep.readyString == nil && dep.readyPort == 0 {
+			ready = dep.firstOutput
+		}
+		select {
+		case <-ready:
+			continue
+		default:
+		}
+		if !proc.silent {
+			proc.writeDebug(fmt.Sprintf("Waiting for %s...", name))
+		}
+		select {
+		case <-ready:
+		case <-pm.shutdown:
+			return false
+		}
+	}
+	return true
+}
+
+// checkWaitFor checks that each process waits only for processes that exist,
+// and that no processes wait for each other.
+func checkWaitFor(procs []*process) error {
+	byName := make(map[string]*process, len(procs))
+	for _, proc := range procs {
+		byName[proc.Name] = proc
+	}
+	for _, proc := range procs {
+		for _, name := range proc.waitFor {
+			if _, ok := byName[name]; !ok {
+				return configErrorf(ErrKindUnknownProcess, "process %q waits for unknown process %q", proc.Name, name)
+			}
+		}
+	}
+	// Walk each process's dependencies, marking those being walked, so
+	// reaching one again means there's a cycle.
+	const (
+		walking = 1
+		walked  = 2
+	)
+	state := make(map[string]int, len(procs))
+	var walk func(name string, path []string) error
+	walk = func(name string, path []string) error {
+		switch state[name] {
+		case walking:
+			return fmt.Errorf("processes wait for each other: %s", strings.Join(append(path, name), " -> "))
+		case walked:
+			return nil
+		}
+		state[name] = walking
+		for _, dep := range byName[name].waitFor {
+			if err := walk(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = walked
+		return nil
+	}
+	for _, proc := range procs {
+		if err := walk(proc.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heartbeat writes a status line every heartbeatInterval until stop is
+// closed.
+func (pm *ProcessManager) heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(pm.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fmt.Fprintln(pm.output, ansi.Dim(pm.heartbeatLine()))
+		}
+	}
+}
+
+// heartbeatLine describes which processes are running and which have
+// stopped, like "[heartbeat] running: api, worker | stopped: css (exit 0)".
+func (pm *ProcessManager) heartbeatLine() string {
+	var running, stopped []string
+	for _, proc := range pm.processes() {
+		pid, state := proc.proc()
+		switch {
+		case pid != 0 && state == nil:
+			running = append(running, proc.Name)
+		case state != nil:
+			stopped = append(stopped, fmt.Sprintf("%s (exit %d)", proc.Name, state.ExitCode()))
+		default:
+			stopped = append(stopped, proc.Name)
+		}
+	}
+	var parts []string
+	if len(running) > 0 {
+		parts = append(parts, "running: "+strings.Join(running, ", "))
+	}
+	if len(stopped) > 0 {
+		parts = append(parts, "stopped: "+strings.Join(stopped, ", "))
+	}
+	return "[heartbeat] " + strings.Join(parts, " | ")
+}
+
 func (pm *ProcessManager) waitForDoneOrInterrupt() {
+	done := pm.done
+	if pm.noAutoExit || pm.pipe != nil {
+		done = nil // Never stop because of a process exiting
+	}
 	select {
-	case <-pm.done:
-	case <-pm.interrupted:
+	case <-pm.finished:
+	case <-done:
+	case sig := <-pm.interrupted:
+		pm.exitMu.Lock()
+		pm.exitSignal = sig
+		pm.exitMu.Unlock()
+	case <-pm.stop:
 	}
 }
 
-func (pm *ProcessManager) waitForTimeoutOrInterrupt() {
+func (pm *ProcessManager) waitForTimeoutOrInterrupt(timeout time.Duration) {
 	select {
-	case <-time.After(pm.timeout):
+	case <-time.After(timeout):
 	case <-pm.interrupted:
 	}
 }
 
+// drainDone discards exits queued on the done channel. Whichever exit woke
+// waitForDoneOrInterrupt has already been read, and recordExit keeps the one
+// that caused shutdown, so any others queued alongside it are only drained
+// so they aren't left behind.
+func (pm *ProcessManager) drainDone() {
+	for {
+		select {
+		case <-pm.done:
+		default:
+			return
+		}
+	}
+}
+
+// beginShutdown closes the shutdown channel, telling everything that's
+// waiting on it that processes are being stopped. It's safe to call more than
+// once.
+func (pm *ProcessManager) beginShutdown() {
+	pm.shutdownOnce.Do(func() { close(pm.shutdown) })
+}
+
 func (pm *ProcessManager) waitForExit() {
 	pm.waitForDoneOrInterrupt()
-	for _, proc := range pm.procs {
+	pm.drainDone()
+	pm.beginShutdown()
+	for _, proc := range pm.processes() {
 		go proc.Interrupt()
 	}
-	pm.waitForTimeoutOrInterrupt()
-	for _, proc := range pm.procs {
-		go proc.Kill()
+
+	// Each process is killed once its own timeout passes, after being asked
+	// to terminate if there's a kill timeout, or all of them are killed at
+	// once if we're interrupted again.
+	kill := make(chan struct{})
+	maxTimeout := time.Duration(0)
+	for _, proc := range pm.processes() {
+		if proc.timeout > maxTimeout {
+			maxTimeout = proc.timeout
+		}
+		go pm.killAfterTimeout(proc, kill)
+	}
+	pm.waitForTimeoutOrInterrupt(maxTimeout + pm.killTimeout)
+	close(kill)
+}
+
+// killAfterTimeout kills an interrupted process if it's still running once
+// its timeout passes, after asking it to terminate if there's a kill timeout.
+// It's killed right away if kill is closed.
+func (pm *ProcessManager) killAfterTimeout(proc *process, kill <-chan struct{}) {
+	select {
+	case <-time.After(proc.timeout):
+	case <-kill:
+		proc.Kill()
+		return
+	}
+	proc.TimedOut()
+	if pm.killTimeout > 0 {
+		proc.Terminate()
+		select {
+		case <-time.After(pm.killTimeout):
+		case <-kill:
+		}
 	}
+	proc.Kill()
 }
 
 type process struct {
@@ -131,43 +2085,304 @@ type process struct {
 	Color  int
 	output *multiOutput
 	silent bool
+
+	timeout time.Duration
+	restart bool
+	killSig syscall.Signal
+	intSig  syscall.Signal
+
+	maxRestarts  int
+	restartDelay time.Duration
+	command      string
+	description  string
+	user         string
+	credential   *syscall.Credential
+	ignoredCodes []int // Exit codes treated as a clean exit
+	startTimeout time.Duration
+	startKill    bool // Whether to kill the process if it hits startTimeout
+	messages     ShutdownMessages
+	socket       *socketAddr // Connected to stdin and stdout, if set
+	customColor  bool        // Whether Color was set, rather than picked from the palette
+	preStart     func(name, cmd string) error
+	postExit     func(name string, exitCode int)
+
+	mu           sync.Mutex
+	lastOutputAt time.Time
+	restarting   bool
+	restarts     int   // Times the process has been restarted, for any reason
+	removed      bool  // Whether the process was removed by Reload
+	usage        usage // Last sampled for metrics
+	paused       bool
+	next         *exec.Cmd // Replaces Cmd on the next reset, after a reload
+	nextCommand  string
+	pid          int              // PID of the last run, or 0 if it hasn't started
+	state        *os.ProcessState // Exit state of the last run, or nil if it hasn't exited
+
+	groups     []string
+	watchGlobs []string // Absolute file patterns that restart the process when matching files change
+	waitFor    []string // Names of processes that must be ready before the process first starts
+
+	readyString []byte
+	readyPort   int
+	ready       chan struct{} // Closed once readyString is seen or readyPort opens
+	readyOnce   sync.Once
+
+	firstOutput     chan struct{} // Closed once the process writes its first line of output
+	firstOutputOnce sync.Once
 }
 
 type processConfig struct {
-	Name   string
-	Cmd    string
-	Dir    string
-	Env    []string
-	Color  int
-	Output *multiOutput
-	Silent bool
+	Name            string
+	Cmd             string
+	Args            []string // If set, run directly instead of Cmd through the shell
+	Shell           string
+	Dir             string
+	Env             []string
+	Color           int
+	Output          *multiOutput
+	Silent          bool
+	PreStartHook    func(name, cmd string) error
+	PostExitHook    func(name string, exitCode int)
+	Timeout         time.Duration
+	Restart         bool
+	KillSignal      syscall.Signal
+	InterruptSignal syscall.Signal
+	MaxRestarts     int
+	RestartDelay    time.Duration
+	ReadyString     string
+	ReadyPort       int
+	Groups          []string
+	Description     string
+	User            string
+	Credential      *syscall.Credential // Set to run as User
+	IgnoreExitCodes []int
+	StartTimeout    time.Duration
+	StartKill       bool
+	Messages        ShutdownMessages
+	Socket          *socketAddr // Connected to stdin and stdout, if set
+	CustomColor     bool
+	WatchGlobs      []string // Absolute file patterns that restart the process when matching files change
+	WaitFor         []string // Names of processes that must be ready before the process first starts
+}
+
+func newProcess(cfg *processConfig) *process {
+	args := cfg.Args
+	if args == nil {
+		shell := cfg.Shell
+		if shell == "" {
+			shell = defaultShell
+		}
+		args = []string{shell, "-c", cfg.Cmd}
+	}
+	p := &process{
+		Cmd:          exec.Command(args[0], args[1:]...),
+		Name:         cfg.Name,
+		Color:        cfg.Color,
+		output:       cfg.Output,
+		silent:       cfg.Silent,
+		command:      cfg.Cmd,
+		description:  cfg.Description,
+		user:         cfg.User,
+		credential:   cfg.Credential,
+		socket:       cfg.Socket,
+		customColor:  cfg.CustomColor,
+		ignoredCodes: cfg.IgnoreExitCodes,
+		startTimeout: cfg.StartTimeout,
+		startKill:    cfg.StartKill,
+		messages:     cfg.Messages,
+		preStart:     cfg.PreStartHook,
+		postExit:     cfg.PostExitHook,
+		timeout:      cfg.Timeout,
+		restart:      cfg.Restart,
+		killSig:      cfg.KillSignal,
+		intSig:       cfg.InterruptSignal,
+		maxRestarts:  cfg.MaxRestarts,
+		restartDelay: cfg.RestartDelay,
+		readyPort:    cfg.ReadyPort,
+		ready:        make(chan struct{}),
+		firstOutput:  make(chan struct{}),
+		groups:       cfg.Groups,
+		watchGlobs:   cfg.WatchGlobs,
+		waitFor:      cfg.WaitFor,
+	}
+	if cfg.ReadyString != "" {
+		p.readyString = []byte(cfg.ReadyString)
+	}
+	p.Cmd.Dir = cfg.Dir
+	p.Cmd.Env = cfg.Env
+	return p
+}
+
+// reset prepares the process to be run again, since an exec.Cmd can only be
+// run once.
+func (p *process) reset() {
+	p.mu.Lock()
+	if p.next != nil {
+		p.Cmd, p.command = p.next, p.nextCommand
+		p.next = nil
+	} else {
+		cmd := exec.Command(p.Args[0], p.Args[1:]...)
+		cmd.Dir = p.Dir
+		cmd.Env = p.Env
+		p.Cmd = cmd
+	}
+	p.pid, p.state = 0, nil
+	p.mu.Unlock()
+	p.setPaused(false)
+}
+
+// update sets the command the process runs from its next reset, reporting
+// whether it differs from the current one.
+func (p *process) update(cmd *exec.Cmd, command string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cur, curCommand := p.Cmd, p.command
+	if p.next != nil {
+		cur, curCommand = p.next, p.nextCommand
+	}
+	if command == curCommand && cmd.Dir == cur.Dir && slices.Equal(cmd.Args, cur.Args) && slices.Equal(cmd.Env, cur.Env) {
+		return false
+	}
+	p.next = cmd
+	p.nextCommand = command
+	return true
+}
+
+// touch records that the process has just produced output. Lines tandem
+// writes about the process don't count.
+func (p *process) touch() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastOutputAt = time.Now()
+}
+
+// idleFor returns how long it's been since the process last produced output.
+func (p *process) idleFor() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Since(p.lastOutputAt)
+}
+
+// takeRestart reports whether a restart was requested for the process, and
+// clears the request.
+func (p *process) takeRestart() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	restart := p.restarting
+	p.restarting = false
+	return restart
+}
+
+// remove marks the process as removed from the config, so it isn't run
+// again.
+func (p *process) remove() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removed = true
+}
+
+func (p *process) isRemoved() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.removed
+}
+
+// countRestart records that the process is being restarted, returning how
+// many times it has been.
+func (p *process) countRestart() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restarts++
+	return p.restarts
+}
+
+func (p *process) restartCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.restarts
+}
+
+// proc returns the PID of the process's last run, or 0 if it hasn't started,
+// and its exit state, or nil if it hasn't exited. The exec.Cmd is only used by
+// the goroutine running it, so other goroutines read these instead.
+func (p *process) proc() (pid int, state *os.ProcessState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pid, p.state
+}
+
+func (p *process) Running() bool {
+	pid, state := p.proc()
+	return pid != 0 && state == nil
+}
+
+// exitErr returns an error if the process's last run failed to start or
+// didn't exit cleanly.
+func (p *process) exitErr() error {
+	_, state := p.proc()
+	if state == nil {
+		return fmt.Errorf("%s failed to start", p.Name)
+	}
+	if !p.cleanExit(state) {
+		return fmt.Errorf("%s exited: %v", p.Name, state)
+	}
+	return nil
+}
+
+// exitedCleanly reports whether the process's last run exited successfully,
+// or with one of its ignored exit codes.
+func (p *process) exitedCleanly() bool {
+	_, state := p.proc()
+	return state != nil && p.cleanExit(state)
+}
+
+func (p *process) cleanExit(state *os.ProcessState) bool {
+	return state.Success() || slices.Contains(p.ignoredCodes, state.ExitCode())
 }
 
-func newProcess(cfg *processConfig) *process {
-	p := &process{
-		Cmd:    exec.Command("/bin/sh", "-c", cfg.Cmd),
-		Name:   cfg.Name,
-		Color:  cfg.Color,
-		output: cfg.Output,
-		silent: cfg.Silent,
+// ExitCode returns the exit code of the process, or -1 if it hasn't exited
+// or was killed by a signal.
+func (p *process) ExitCode() int {
+	_, state := p.proc()
+	if state == nil {
+		return -1
 	}
-	p.Cmd.Dir = cfg.Dir
-	p.Cmd.Env = cfg.Env
-	p.output.Connect(p)
-	return p
+	return state.ExitCode()
 }
 
-func (p *process) Running() bool {
-	return p.Process != nil && p.ProcessState == nil
+// status describes what the process is doing, like "running" or "exited 1".
+func (p *process) status() string {
+	pid, state := p.proc()
+	switch {
+	case pid == 0 && p.restartCount() > 0:
+		return "restarting"
+	case pid == 0:
+		return "waiting"
+	case state == nil && p.isPaused():
+		return "paused"
+	case state == nil:
+		return "running"
+	case state.ExitCode() == -1:
+		return "killed"
+	}
+	return fmt.Sprintf("exited %d", state.ExitCode())
 }
 
+// signal sends a signal to the process's group. The process may exit after
+// it's checked to be running but before it's signalled, so errors saying it's
+// already gone are ignored.
 func (p *process) signal(sig os.Signal) {
-	group, err := os.FindProcess(-p.Process.Pid)
+	pid, _ := p.proc()
+	if pid == 0 {
+		return
+	}
+	group, err := os.FindProcess(-pid)
 	if err != nil {
 		p.writeErr(err)
 		return
 	}
-	if err = group.Signal(sig); err != nil {
+	err = group.Signal(sig)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH) {
 		p.writeErr(err)
 	}
 }
@@ -185,125 +2400,589 @@ func (p *process) writeErr(err error) {
 }
 
 func (p *process) Run() {
+	if p.preStart != nil {
+		if err := p.preStart(p.Name, p.command); err != nil {
+			p.writeErr(err)
+			return
+		}
+	}
 	p.output.PipeOutput(p)
 	defer p.output.ClosePipe(p)
+	if p.socket != nil {
+		// Only stderr goes to the terminal, so it's still shown. Without the
+		// terminal as stdin, it can't be the controlling terminal.
+		f, err := p.socket.dial()
+		if err != nil {
+			p.writeErr(err)
+			return
+		}
+		defer f.Close()
+		p.Stdin, p.Stdout = f, f
+		p.SysProcAttr.Setctty = false
+	}
+	p.touch()
 	if !p.silent {
 		p.writeDebug("Starting...")
 	}
-	if err := p.Cmd.Run(); err != nil {
+	if p.readyPort > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go p.pollReadyPort(stop)
+	}
+	if p.startTimeout > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		lines, _ := p.output.Stats(p)
+		go p.watchStart(lines, stop)
+	}
+	start := time.Now()
+	err := p.Cmd.Start()
+	if err == nil {
+		p.mu.Lock()
+		p.pid = p.Cmd.Process.Pid
+		p.mu.Unlock()
+		err = p.Cmd.Wait()
+	}
+	p.mu.Lock()
+	p.state = p.Cmd.ProcessState
+	p.mu.Unlock()
+	elapsed := time.Since(start)
+	p.runPostExit(err)
+	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
-			if exitErr.ExitCode() == 1 {
+			if exitErr.ExitCode() == 1 && !slices.Contains(p.ignoredCodes, 1) {
 				p.writeErr(err)
 			} else {
 				p.writeLine([]byte(ansi.Dim(fmt.Sprintf("exit status %d", exitErr.ExitCode()))))
 			}
 			return
 		}
+		if p.credential != nil && errors.Is(err, syscall.EPERM) {
+			err = fmt.Errorf("couldn't run as user %q, which needs tandem to run as root or with CAP_SETUID: %v", p.user, err)
+		}
 		p.writeErr(err)
 		return
 	}
 	if !p.silent {
-		p.writeDebug("Process exited")
+		p.writeDebug(fmt.Sprintf("Process exited (%s)", formatDuration(elapsed)))
+	}
+}
+
+// runPostExit calls the post-exit hook, if any, with the exit code for the
+// given error from running the command. It waits for the hook to return for at
+// most postExitHookTimeout.
+func (p *process) runPostExit(err error) {
+	if p.postExit == nil {
+		return
+	}
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.postExit(p.Name, exitCode)
+	}()
+	select {
+	case <-done:
+	case <-time.After(postExitHookTimeout):
+		p.writeErr(fmt.Errorf("post-exit hook did not finish within %v", postExitHookTimeout))
 	}
 }
 
 func (p *process) Interrupt() {
 	if p.Running() {
 		if !p.silent {
-			p.writeDebug("Interrupting...")
+			p.writeDebug(p.messages.format(p.messages.Interrupting, "Interrupting...", p))
+		}
+		p.signal(p.intSig)
+		// A stopped process won't handle the signal until it's continued.
+		if p.isPaused() {
+			p.setPaused(false)
+			p.signal(syscall.SIGCONT)
 		}
-		p.signal(syscall.SIGINT)
 	}
 }
 
-func (p *process) Kill() {
+func (p *process) Pause() {
+	if p.Running() && !p.isPaused() {
+		p.setPaused(true)
+		p.signal(syscall.SIGSTOP)
+		if !p.silent {
+			p.writeDebug("Paused")
+		}
+	}
+}
+
+func (p *process) Resume() {
+	if p.Running() && p.isPaused() {
+		p.setPaused(false)
+		p.touch() // Don't count time spent paused against the watchdog
+		p.signal(syscall.SIGCONT)
+		if !p.silent {
+			p.writeDebug("Resumed")
+		}
+	}
+}
+
+// checkReady marks the process as ready if a line of its output contains its
+// ready string.
+func (p *process) checkReady(line []byte) {
+	if p.readyString == nil {
+		return
+	}
+	if bytes.IndexByte(line, '\x1b') >= 0 {
+		line = []byte(ansi.Strip(string(line)))
+	}
+	if bytes.Contains(line, p.readyString) {
+		p.markReady()
+	}
+}
+
+// watchStart warns if the process hasn't written any output by the time its
+// start timeout is up, killing it if startKill is set. lines is how many
+// lines it had written before starting. It stops early if stop is closed.
+func (p *process) watchStart(lines int64, stop <-chan struct{}) {
+	timer := time.NewTimer(p.startTimeout)
+	defer timer.Stop()
+	select {
+	case <-stop:
+		return
+	case <-timer.C:
+	}
+	if n, _ := p.output.Stats(p); n > lines {
+		return
+	}
+	p.writeErr(errors.New("start timeout exceeded — process may be hung"))
+	if p.startKill {
+		p.Kill()
+	}
+}
+
+// pollReadyPort marks the process as ready once something accepts
+// connections on its ready port, checking until stop is closed.
+func (p *process) pollReadyPort(stop <-chan struct{}) {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.readyPort))
+	ticker := time.NewTicker(readyPortInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-p.ready:
+			return
+		case <-ticker.C:
+			conn, err := net.DialTimeout("tcp", addr, readyPortInterval)
+			if err == nil {
+				conn.Close()
+				p.markReady()
+				return
+			}
+		}
+	}
+}
+
+// markOutput closes the process's firstOutput channel the first time it's
+// called.
+func (p *process) markOutput() {
+	p.firstOutputOnce.Do(func() {
+		if p.firstOutput != nil {
+			close(p.firstOutput)
+		}
+	})
+}
+
+// markReady closes the process's ready channel, printing a message the first
+// time it's called.
+func (p *process) markReady() {
+	first := false
+	p.readyOnce.Do(func() {
+		close(p.ready)
+		first = true
+	})
+	if first && !p.silent {
+		p.writeDebug("Ready")
+	}
+}
+
+func (p *process) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+func (p *process) setPaused(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = paused
+}
+
+// Restart kills the process so that it's started again once it exits. The
+// given reason is printed unless the process is silent.
+func (p *process) Restart(reason string) {
 	if p.Running() {
+		p.mu.Lock()
+		p.restarting = true
+		p.mu.Unlock()
 		if !p.silent {
-			p.writeDebug("Killing...")
+			p.writeDebug(reason)
 		}
 		p.signal(syscall.SIGKILL)
 	}
 }
 
+// TimedOut reports that the process hasn't exited within its timeout, if
+// there's a message to report it with.
+func (p *process) TimedOut() {
+	if p.Running() && !p.silent && p.messages.TimedOut != "" {
+		p.writeDebug(p.messages.format(p.messages.TimedOut, "", p))
+	}
+}
+
+// Terminate asks the process to exit with SIGTERM, after it's been
+// interrupted but before it's killed.
+func (p *process) Terminate() {
+	if p.Running() {
+		if !p.silent {
+			p.writeDebug("Terminating...")
+		}
+		p.signal(syscall.SIGTERM)
+	}
+}
+
+func (p *process) Kill() {
+	if p.Running() {
+		if !p.silent {
+			p.writeDebug(p.messages.format(p.messages.Killing, "Killing...", p))
+		}
+		p.signal(p.killSig)
+	}
+}
+
 type command struct {
-	name string
-	cmd  string
+	name     string
+	explicit bool // Whether name was given by the user, rather than derived from cmd
+	cmd      string
+	dir      string   // Directory to run in, if different from the root
+	env      []string // Extra environment variables in "KEY=VALUE" format
+	restart  bool     // Whether to restart the command if it fails
+
+	color       int  // ANSI color index to label output with
+	customColor bool // Whether color was set, rather than picked from the palette
+
+	// Settings from a ProcessConfig, overriding the process manager's.
+	maxRestarts     int
+	restartDelay    time.Duration
+	silent          bool
+	interruptSignal string
+	killSignal      string
+	groups          []string
+	description     string
+	user            string // Unix user to run as, if not the current one
+	script          string // Name of the package.json script run, if any
+	socket          *socketAddr
+	watchGlobs      []string
+	waitFor         []string
 }
 
-func parseCommands(root string, cmds []string) ([]command, error) {
+type parseOptions struct {
+	npxArgs           []string // Extra arguments for commands prefixed with 'npx:'
+	bunArgs           []string // Extra arguments to 'bun run' for commands prefixed with 'bun:'
+	noPackageJSONWalk bool     // Whether to only look for package.json in the root
+	exec              bool     // Whether commands are run without a shell
+	allowedScripts    []string // If set, the only npm scripts wildcards can match
+	ignoredScripts    []string // Patterns of npm scripts wildcards never match
+
+	skipMissingWorkspaceScripts bool      // Whether to skip workspaces without a script, rather than error
+	warn                        io.Writer // Where to warn about skipped scripts, if anywhere
+}
+
+// parseCommands parses a list of command strings into named commands. If any
+// npm scripts are referenced, it also returns the path of the package.json
+// they were read from.
+func parseCommands(root string, cmds []string, opts parseOptions) ([]command, string, error) {
 	var result []command
 	var npmCommands []string
+	var bunCommands []string
+	var npmColors []command // npm and bun commands with custom colors, by script pattern
+	var npmUsers []command  // npm and bun commands run as other users, by script pattern
+	var npmEnvs []command   // npm and bun commands with env files, by script pattern
+	var workspaceCommands []string
 	for _, cmd := range cmds {
+		prefixes, cmd, err := parseCmdPrefixes(cmd)
+		if err != nil {
+			return nil, "", err
+		}
+		var env []string
+		if prefixes.envFile != "" {
+			if env, err = loadEnvFile(root, prefixes.envFile); err != nil {
+				return nil, "", err
+			}
+		}
 		name := filterCmdName(cmd)
 		if name == "" {
 			name = "cmd"
 		}
-		if strings.HasPrefix(name, "npm:") {
-			npmCommands = append(npmCommands, cmd)
-			continue
+		// Commands prefixed with 'npx:' are run through npx, and named after
+		// the package binary.
+		if strings.HasPrefix(name, "npx:") {
+			bin := strings.TrimPrefix(strings.TrimSpace(cmd), "npx:")
+			name = filterCmdName(bin)
+			if name == "" {
+				return nil, "", fmt.Errorf("no package given for %q", cmd)
+			}
+			cmd = strings.Join(append(append([]string{"npx"}, opts.npxArgs...), bin), " ")
+		}
+		if prefixes.socket != nil && (isScriptCmd(name) || isWorkspaceCmd(cmd)) {
+			return nil, "", fmt.Errorf("socket: can't be used with package.json scripts: %q", cmd)
+		}
+		if (strings.HasPrefix(name, "npm:") || isWorkspaceCmd(cmd)) && opts.exec {
+			return nil, "", fmt.Errorf("npm scripts can't be run with exec: %q", cmd)
+		}
+		if isScriptCmd(name) && prefixes.customColor {
+			npmColors = append(npmColors, command{
+				name:        trimScriptPrefix(strings.TrimSpace(cmd)),
+				color:       prefixes.color,
+				customColor: true,
+			})
+		}
+		if isScriptCmd(name) && prefixes.user != "" {
+			npmUsers = append(npmUsers, command{
+				name: trimScriptPrefix(strings.TrimSpace(cmd)),
+				user: prefixes.user,
+			})
+		}
+		if isScriptCmd(name) && env != nil {
+			npmEnvs = append(npmEnvs, command{
+				name: trimScriptPrefix(strings.TrimSpace(cmd)),
+				env:  env,
+			})
+		}
+		for i := 0; i < prefixes.count; i++ {
+			if isWorkspaceCmd(cmd) {
+				workspaceCommands = append(workspaceCommands, cmd)
+				continue
+			}
+			if strings.HasPrefix(name, "npm:") {
+				npmCommands = append(npmCommands, cmd)
+				continue
+			}
+			if strings.HasPrefix(name, "bun:") {
+				bunCommands = append(bunCommands, cmd)
+				continue
+			}
+			result = append(result, command{
+				name:        name,
+				cmd:         cmd,
+				color:       prefixes.color,
+				customColor: prefixes.customColor,
+				user:        prefixes.user,
+				env:         env,
+				socket:      prefixes.socket,
+			})
 		}
-		result = append(result, command{
-			name: name,
-			cmd:  cmd,
-		})
 	}
 
-	// For commands prefixed with 'npm:', read the command contents from
-	// the package.json file. Error on any missing commands.
-	if len(npmCommands) > 0 {
-		b, err := os.ReadFile(filepath.Join(root, "package.json"))
+	// Commands prefixed with 'workspace:' run a script in each matching
+	// package listed in the workspaces of package.json.
+	var workspacePkgPath string
+	if len(workspaceCommands) > 0 {
+		pkgPath, err := findPackageJSON(root, !opts.noPackageJSONWalk)
 		if err != nil {
-			return nil, fmt.Errorf("reading package.json: %v", err)
+			return nil, "", err
 		}
-		scripts, err := parseNpmScripts(b, npmCommands)
+		scripts, err := parseWorkspaceScripts(pkgPath, workspaceCommands, opts.skipMissingWorkspaceScripts, opts.warn)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		result = append(result, scripts...)
+		workspacePkgPath = pkgPath
+	}
+
+	// For commands prefixed with 'npm:' or 'bun:', read the command contents
+	// from the package.json file. Error on any missing commands.
+	if len(npmCommands) > 0 || len(bunCommands) > 0 {
+		pkgPath, err := findPackageJSON(root, !opts.noPackageJSONWalk)
+		if err != nil {
+			return nil, "", err
+		}
+		b, err := os.ReadFile(pkgPath)
+		if err != nil {
+			return nil, "", configErrorf(ErrKindBadPackageJSON, "reading package.json: %v", err)
+		}
+		scripts, err := parseNpmScripts(b, npmCommands, opts.allowedScripts, opts.ignoredScripts)
+		if err != nil {
+			return nil, "", err
+		}
+		bunScripts, err := parseNpmScripts(b, bunCommands, opts.allowedScripts, opts.ignoredScripts)
+		if err != nil {
+			return nil, "", err
+		}
+		// Bun scripts are run through bun so its lifecycle hooks run too.
+		for i, script := range bunScripts {
+			bunScripts[i].cmd = strings.Join(append(append([]string{"bun", "run"}, opts.bunArgs...), script.script), " ")
+		}
+		scripts = append(scripts, bunScripts...)
+		for i, script := range scripts {
+			// Scripts run from the directory containing package.json, like
+			// they would with npm run.
+			if dir := filepath.Dir(pkgPath); dir != root {
+				scripts[i].dir = dir
+			}
+			for _, c := range npmColors {
+				if wildcardMatch(c.name, script.script) {
+					scripts[i].color = c.color
+					scripts[i].customColor = true
+					break
+				}
+			}
+			for _, u := range npmUsers {
+				if wildcardMatch(u.name, script.script) {
+					scripts[i].user = u.user
+					break
+				}
+			}
+			for _, e := range npmEnvs {
+				if wildcardMatch(e.name, script.script) {
+					scripts[i].env = e.env
+					break
+				}
+			}
+		}
+		return append(result, scripts...), pkgPath, nil
+	}
+	return result, workspacePkgPath, nil
+}
+
+// isScriptCmd reports whether a command refers to package.json scripts, with
+// an 'npm:' or 'bun:' prefix.
+func isScriptCmd(cmd string) bool {
+	return strings.HasPrefix(cmd, "npm:") || strings.HasPrefix(cmd, "bun:")
+}
+
+// trimScriptPrefix removes the 'npm:' or 'bun:' prefix from a command.
+func trimScriptPrefix(cmd string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(cmd, "npm:"), "bun:")
+}
+
+// findPackageJSON returns the path to the package.json file in root. If walk
+// is set and root doesn't have one, its parents are searched too.
+func findPackageJSON(root string, walk bool) (string, error) {
+	dir := root
+	for {
+		path := filepath.Join(dir, "package.json")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", configErrorf(ErrKindBadPackageJSON, "reading package.json: %v", err)
+		}
+		parent := filepath.Dir(dir)
+		if !walk || parent == dir {
+			return "", configErrorf(ErrKindBadPackageJSON, "no package.json found in %s", root)
+		}
+		dir = parent
 	}
+}
 
-	// If there are multiple processes with the same name, append a number to each
-	// one, so we can distinguish them.
+// uniqueNames appends a number to the names of commands that share the same
+// name, so we can distinguish them. Only names derived from the command are
+// changed, and numbers that would clash with another name are skipped. Names
+// given explicitly must already be unique.
+func uniqueNames(result []command) ([]command, error) {
+	explicitNames := map[string]bool{}
+	var order []string             // derived names, in order of first use
 	namesMap := map[string][]int{} // name -> indexes of procs with name
 	for i, cmd := range result {
 		name := cmd.name
+		if cmd.explicit {
+			if explicitNames[name] {
+				return nil, fmt.Errorf("multiple processes named %q", name)
+			}
+			explicitNames[name] = true
+			continue
+		}
+		if _, ok := namesMap[name]; !ok {
+			order = append(order, name)
+		}
 		namesMap[name] = append(namesMap[name], i)
 	}
+	taken := map[string]bool{}
+	for name := range explicitNames {
+		taken[name] = true
+	}
 	for name, idxs := range namesMap {
-		if len(idxs) > 1 {
-			for i, idx := range idxs {
-				cmd := result[idx]
-				cmd.name = fmt.Sprintf("%s.%d", name, i+1)
-				result[idx] = cmd
+		if len(idxs) == 1 && !explicitNames[name] {
+			taken[name] = true
+		}
+	}
+	for _, name := range order {
+		idxs := namesMap[name]
+		if len(idxs) == 1 && !explicitNames[name] {
+			continue
+		}
+		n := 1
+		for _, idx := range idxs {
+			for taken[fmt.Sprintf("%s.%d", name, n)] {
+				n++
 			}
+			cmd := result[idx]
+			cmd.name = fmt.Sprintf("%s.%d", name, n)
+			taken[cmd.name] = true
+			result[idx] = cmd
+			n++
 		}
 	}
 	return result, nil
 }
 
 type packageJSON struct {
+	Version string            `json:"version"`
 	Scripts map[string]string `json:"scripts"`
 }
 
+// packageVersion returns the version field of the package.json at path, or
+// an empty string if it can't be read or has no version.
+func packageVersion(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(b, &pkg); err != nil {
+		return ""
+	}
+	return pkg.Version
+}
+
+// isScriptComment reports whether a package.json script name is a "//"
+// comment key, which some tools use to document scripts.
+func isScriptComment(name string) bool {
+	return strings.HasPrefix(name, "//")
+}
+
 // parseNpmScripts parses a package.json file and set of command strings, and
 // returns a set of named commands, including the paths to run for each command.
-func parseNpmScripts(b []byte, cmds []string) ([]command, error) {
+// If allowed is non-nil, wildcards only match scripts it contains, and they
+// never match scripts matching a pattern in ignored.
+func parseNpmScripts(b []byte, cmds []string, allowed, ignored []string) ([]command, error) {
 	var pkg packageJSON
 	if err := json.Unmarshal(b, &pkg); err != nil {
-		return nil, fmt.Errorf("parsing package.json: %v", err)
+		return nil, configErrorf(ErrKindBadPackageJSON, "parsing package.json: %v", err)
 	}
 
 	var result []command
 	var missingCommands []string
 	for _, cmd := range cmds {
-		scriptName := strings.TrimPrefix(cmd, "npm:")
+		scriptName := trimScriptPrefix(cmd)
 		if s, ok := pkg.Scripts[scriptName]; ok {
 			// Exact match? Add it to the list.
-			result = append(result, command{
-				name: scriptName,
-				cmd:  s,
-			})
+			result = append(result, scriptCommand(scriptName, s))
 			continue
 		}
 		if !strings.Contains(scriptName, "*") {
@@ -313,17 +2992,20 @@ func parseNpmScripts(b []byte, cmds []string) ([]command, error) {
 		// Check if scriptName wildcard matches scriptName
 		hasMatch := false
 		for name, pcmd := range pkg.Scripts {
-			if !wildcardMatch(scriptName, name) {
+			if isScriptComment(name) || !wildcardMatch(scriptName, name) {
 				continue
 			}
-			result = append(result, command{
-				name: name,
-				cmd:  pcmd,
-			})
+			if allowed != nil && !slices.Contains(allowed, name) {
+				continue
+			}
+			if isIgnoredScript(name, ignored) {
+				continue
+			}
+			result = append(result, scriptCommand(name, pcmd))
 			hasMatch = true
 		}
 		if !hasMatch {
-			return nil, fmt.Errorf("no npm scripts matching %q found in package.json", scriptName)
+			return nil, configErrorf(ErrKindMissingScript, "no npm scripts matching %q found in package.json", scriptName)
 		}
 	}
 	if len(missingCommands) > 0 {
@@ -331,11 +3013,59 @@ func parseNpmScripts(b []byte, cmds []string) ([]command, error) {
 		if len(missingCommands) != 1 {
 			noun = "scripts"
 		}
-		return nil, fmt.Errorf("no npm %s named %q found in package.json", noun, strings.Join(missingCommands, ","))
+		return nil, configErrorf(ErrKindMissingScript, "no npm %s named %q found in package.json", noun, strings.Join(missingCommands, ","))
 	}
 	return result, nil
 }
 
+// scriptCommand returns the command for a package.json script. Scripts are
+// named after their key, unless they start with a "# tandem:name=<name>" line
+// or a "/* tandem:name=<name> */" comment, which is removed from the command.
+func scriptCommand(script, cmd string) command {
+	name := script
+	s := strings.TrimLeft(cmd, " \t")
+	var directive, rest string
+	var ok bool
+	switch {
+	case strings.HasPrefix(s, "#"):
+		directive, rest, _ = strings.Cut(strings.TrimPrefix(s, "#"), "\n")
+		ok = true
+	case strings.HasPrefix(s, "/*"):
+		directive, rest, ok = strings.Cut(strings.TrimPrefix(s, "/*"), "*/")
+	}
+	directive = strings.TrimSpace(directive)
+	if ok && strings.HasPrefix(directive, "tandem:name=") {
+		if label := strings.TrimSpace(strings.TrimPrefix(directive, "tandem:name=")); label != "" {
+			name, cmd = label, strings.TrimSpace(rest)
+		}
+	}
+	return command{name: name, cmd: cmd, script: script}
+}
+
+// findNodeBins returns the node_modules/.bin directories in dir and each of
+// its parents up to root, closest first. If dir isn't inside root, only dir is
+// checked.
+func findNodeBins(dir, root string) []string {
+	var bins []string
+	for {
+		bin := filepath.Join(dir, "node_modules", ".bin")
+		if fi, err := os.Stat(bin); err == nil && fi.IsDir() {
+			bins = append(bins, bin)
+		}
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir || !isWithin(parent, root) {
+			return bins
+		}
+		dir = parent
+	}
+}
+
+// isWithin returns whether path is dir or inside of it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // injectPathVal injects a value into the start of a PATH environment variable.
 // It expects a string slice of env variables in "KEY=VALUE" format, like those
 // provided from os.Environ().
@@ -351,6 +3081,161 @@ func injectPathVal(env []string, val string) []string {
 	return env
 }
 
+// cmdPrefixes are the settings given by prefixes on a command, like "N*" or
+// "color(N):".
+type cmdPrefixes struct {
+	count       int
+	color       int
+	customColor bool
+	user        string
+	envFile     string
+	socket      *socketAddr
+}
+
+// parseCmdPrefixes parses the prefixes of a command, which can be given in any
+// order, but each only once. It returns them and the command with them
+// removed.
+func parseCmdPrefixes(cmd string) (cmdPrefixes, string, error) {
+	p := cmdPrefixes{count: 1}
+	seen := make(map[string]bool)
+	s := strings.TrimSpace(cmd)
+	for {
+		var name, rest string
+		var err error
+		switch {
+		case strings.HasPrefix(s, "color("):
+			name = "color"
+			p.color, p.customColor, rest, err = parseCmdColor(s)
+		case strings.HasPrefix(s, "user("):
+			name = "user"
+			p.user, rest, err = parseCmdUser(s)
+		case strings.HasPrefix(s, "env-file("):
+			name = "env-file"
+			p.envFile, rest, err = parseCmdEnvFile(s)
+		case strings.HasPrefix(s, "socket:"):
+			name = "socket"
+			p.socket, rest, err = parseCmdSocket(s)
+		default:
+			var count int
+			if count, rest, err = parseCmdCount(s); err == nil && rest == s {
+				// There are no more prefixes.
+				if len(seen) == 0 {
+					return p, cmd, nil
+				}
+				return p, s, nil
+			}
+			name, p.count = "count", count
+		}
+		if err != nil {
+			return cmdPrefixes{}, "", err
+		}
+		if seen[name] {
+			return cmdPrefixes{}, "", fmt.Errorf("%s prefix given more than once in %q", name, cmd)
+		}
+		seen[name] = true
+		s = rest
+	}
+}
+
+// parseCmdCount parses an optional "N*" prefix from a command, which is used
+// to run N instances of the same command in parallel. It returns the count and
+// the command with the prefix removed. Commands without a prefix have a count
+// of 1.
+func parseCmdCount(cmd string) (int, string, error) {
+	s := strings.TrimSpace(cmd)
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 || i == len(s) || s[i] != '*' {
+		return 1, cmd, nil
+	}
+	count, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, "", fmt.Errorf("parsing count for %q: %v", cmd, err)
+	}
+	if count < 1 {
+		return 0, "", fmt.Errorf("count for %q must be at least 1, got %d", cmd, count)
+	}
+	return count, strings.TrimSpace(s[i+1:]), nil
+}
+
+// parseCmdColor parses an optional "color(N):" prefix from a command, which
+// sets the ANSI color index used to label the command's output. It returns the
+// color, whether one was given, and the command with the prefix removed.
+func parseCmdColor(cmd string) (int, bool, string, error) {
+	s := strings.TrimSpace(cmd)
+	if !strings.HasPrefix(s, "color(") {
+		return 0, false, cmd, nil
+	}
+	val, rest, ok := strings.Cut(strings.TrimPrefix(s, "color("), "):")
+	if !ok {
+		return 0, false, "", fmt.Errorf("invalid color prefix in %q, expected color(<0-255>):<command>", cmd)
+	}
+	color, err := strconv.Atoi(val)
+	if err != nil || !ansi.IsValidColor(color) {
+		return 0, false, "", fmt.Errorf("invalid color %q in %q, expected a number from 0 to 255", val, cmd)
+	}
+	return color, true, strings.TrimSpace(rest), nil
+}
+
+// colorForName picks a color from the palette based on an FNV-1a hash of name.
+func colorForName(name string, palette []int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return palette[h.Sum32()%uint32(len(palette))]
+}
+
+// colorPalette returns the palette to pick process colors from: the given
+// colors if there are any, then those in TANDEM_COLORS, then the default.
+// Invalid colors in TANDEM_COLORS are warned about and ignored.
+func colorPalette(custom []int, warn io.Writer) ([]int, error) {
+	if len(custom) > 0 {
+		for _, c := range custom {
+			if !ansi.IsValidColor(c) {
+				return nil, fmt.Errorf("invalid color %d, expected a number from 0 to 255", c)
+			}
+		}
+		return custom, nil
+	}
+	env := os.Getenv("TANDEM_COLORS")
+	if env == "" {
+		return colors, nil
+	}
+	palette, err := parseColors(env)
+	if err != nil {
+		fmt.Fprintf(warn, "tandem: warning: ignoring TANDEM_COLORS: %v\n", err)
+		return colors, nil
+	}
+	return palette, nil
+}
+
+// parseColors parses a comma-separated list of 256-color ANSI indexes.
+func parseColors(s string) ([]int, error) {
+	var result []int
+	for _, v := range strings.Split(s, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || !ansi.IsValidColor(c) {
+			return nil, fmt.Errorf("invalid color %q, expected a number from 0 to 255", v)
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// formatDuration formats a duration for display, in milliseconds, seconds, or
+// minutes depending on how long it is.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return fmt.Sprintf("%.1fm", d.Minutes())
+	}
+}
+
 // filterCmdName returns the name of the command to be run, filtering out any
 // path information.
 func filterCmdName(cmd string) string {
@@ -362,6 +3247,108 @@ func filterCmdName(cmd string) string {
 	return name
 }
 
+// checkPorts returns a copy of the given ports by process name, or an error
+// if any are invalid or given to more than one process.
+func checkPorts(ports map[string]int) (map[string]int, error) {
+	names := make([]string, 0, len(ports))
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]int, len(ports))
+	byPort := make(map[int]string, len(ports))
+	for _, name := range names {
+		port := ports[name]
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %d for %q", port, name)
+		}
+		if other, ok := byPort[port]; ok {
+			return nil, fmt.Errorf("port %d given to both %q and %q", port, other, name)
+		}
+		byPort[port] = name
+		result[name] = port
+	}
+	return result, nil
+}
+
+// goRaceCmd matches Go commands that accept the -race flag, along with the
+// flags before their first argument.
+var goRaceCmd = regexp.MustCompile(`^(\s*go\s+(?:build|install|run|test))((?:\s+-\S*)*)(?:\s|$)`)
+
+// addRaceFlag adds the -race flag to a Go command, if it accepts one and
+// doesn't have it already. Only the command's own flags are checked, so
+// arguments to the program it runs are left alone.
+func addRaceFlag(cmd string) string {
+	m := goRaceCmd.FindStringSubmatchIndex(cmd)
+	if m == nil {
+		return cmd
+	}
+	for _, f := range strings.Fields(cmd[m[4]:m[5]]) {
+		name := strings.TrimLeft(f, "-")
+		if name == "race" || strings.HasPrefix(name, "race=") {
+			return cmd
+		}
+	}
+	return cmd[:m[3]] + " -race" + cmd[m[3]:]
+}
+
+// splitArgs splits a command into arguments the way a shell would, honoring
+// single quotes, double quotes, and backslash escapes. It doesn't expand
+// variables or globs.
+func splitArgs(cmd string) ([]string, error) {
+	var (
+		args    []string
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			// Inside double quotes, a backslash only escapes a few characters.
+			if quote == '"' && !strings.ContainsRune(`"\$`+"`", r) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
 // wildcardMatch takes a pattern that optionally includes a * character, and
 // returns whether or not string s matches that wildcard. The matching currently
 // only supports one wildcard and prefix/suffix matching.
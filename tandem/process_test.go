@@ -2,22 +2,1538 @@ package tandem
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rosszurowski/tandem/ansi"
 	"golang.org/x/exp/slices"
 )
 
+// TestMain runs the tests from a temporary directory, so managers without a
+// Root don't write their lock files into the source tree.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tandem-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestGoAPI(t *testing.T) {
 	ansi.NoColor = true
 	out, err := captureStdout(func() {
 		pm, err := New(Config{
-			Cmds:   []string{"echo 'hello' && sleep 0.15", "echo 'world' && sleep 0.15"},
+			Cmds:   []string{"echo 'hello' && sleep 0.15", "echo 'world' && sleep 0.15"},
+			Silent: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.Run()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasCmd1 := strings.Contains(out, "echo.1  hello")
+	hasCmd2 := strings.Contains(out, "echo.2  world")
+	if !hasCmd1 || !hasCmd2 {
+		t.Fatalf("expected output to contain both commands, got %q", out)
+	}
+}
+
+func TestMustNew(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected MustNew to panic on an invalid config")
+		}
+	}()
+	MustNew(Config{Cmds: []string{"0*echo"}})
+}
+
+func TestNames(t *testing.T) {
+	pm := MustNew(Config{Cmds: []string{"echo a", "echo b", "sleep 1"}})
+	if pm.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", pm.Len())
+	}
+	if got, want := pm.Names(), []string{"echo.1", "echo.2", "sleep"}; !slices.Equal(got, want) {
+		t.Fatalf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestSortByName(t *testing.T) {
+	pm := MustNew(Config{
+		Cmds:       []string{"sleep 1", "echo a"},
+		Processes:  []ProcessConfig{{Name: "web", Cmd: "true"}, {Name: "api", Cmd: "true"}},
+		SortByName: true,
+	})
+	if got, want := pm.Names(), []string{"api", "echo", "sleep", "web"}; !slices.Equal(got, want) {
+		t.Fatalf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ansi.NoColor = true
+	out, err := captureStdout(func() {
+		MustNew(Config{Cmds: []string{"echo 'hello'", "npx:serve ."}}).DryRun()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "echo   echo 'hello'\nserve  npx serve .\n"
+	if out != want {
+		t.Fatalf("expected dry run output %q, got %q", want, out)
+	}
+}
+
+func TestDryRunDescription(t *testing.T) {
+	ansi.NoColor = true
+	out, err := captureStdout(func() {
+		MustNew(Config{Processes: []ProcessConfig{
+			{Name: "web", Cmd: "gunicorn app:app", Description: "The main web server"},
+		}}).DryRun()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "web  gunicorn app:app  # The main web server\n"
+	if out != want {
+		t.Fatalf("expected dry run output %q, got %q", want, out)
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	ansi.NoColor = true
+	var err error
+	out, _ := captureStdout(func() {
+		err = RunAll(context.Background(), []Config{
+			{Cmds: []string{"sleep 0.1 && exit 3", "sleep 5"}, Silent: true},
+			{Cmds: []string{"sleep 0.2 && echo 'done' && sleep 0.1"}, Silent: true},
+		})
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "group 1") || strings.Contains(err.Error(), "group 2") {
+		t.Fatalf("expected only group 1 to fail, got %v", err)
+	}
+	if !strings.Contains(out, "done") {
+		t.Fatalf("expected group 2 to keep running, got %q", out)
+	}
+}
+
+func TestIgnoreExitCodes(t *testing.T) {
+	ansi.NoColor = true
+	var err error
+	out, _ := captureStdout(func() {
+		err = RunAll(context.Background(), []Config{
+			{Cmds: []string{"sleep 0.1 && exit 1"}, IgnoreExitCodes: []int{1, 130}},
+			{Cmds: []string{"sleep 0.1 && exit 3"}, IgnoreExitCodes: []int{1}},
+		})
+	})
+	if err == nil || strings.Contains(err.Error(), "group 1") || !strings.Contains(err.Error(), "group 2") {
+		t.Fatalf("expected only group 2 to fail, got %v", err)
+	}
+	if !strings.Contains(out, "exit status 1") {
+		t.Fatalf("expected ignored exit code to be shown, got %q", out)
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, IgnoreExitCodes: []int{256}}); err == nil {
+		t.Fatal("expected an error for an invalid exit code")
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "hung", Cmd: "sleep 5"},
+			{Name: "ok", Cmd: "echo hi && sleep 5"},
+		},
+		StartTimeout:     200 * time.Millisecond,
+		StartTimeoutKill: true,
+		Silent:           true,
+	})
+	start := time.Now()
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected hung process to be killed, took %v", elapsed)
+	}
+	if !strings.Contains(out, "hung  start timeout exceeded") || strings.Contains(out, "ok    start timeout exceeded") {
+		t.Fatalf("expected only hung to time out, got %q", out)
+	}
+}
+
+func TestShutdownMessages(t *testing.T) {
+	proc := &process{Name: "api", timeout: 30 * time.Second}
+	msgs := ShutdownMessages{Interrupting: "Waiting up to {timeout} for {name} to exit..."}
+	if got, want := msgs.format(msgs.Interrupting, "Interrupting...", proc), "Waiting up to 30s for api to exit..."; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+	if got, want := msgs.format(msgs.Killing, "Killing...", proc), "Killing..."; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "migrate", Cmd: "echo migrating && sleep 0.1 && exit 2"},
+			{Name: "api", Cmd: "echo api && sleep 0.1"},
+			{Name: "hang", Cmd: "sleep 5"},
+		},
+		Silent: true,
+	})
+	var err error
+	out, _ := captureStdout(func() { err = pm.RunOnce("migrate") })
+	if err == nil || !strings.Contains(err.Error(), "migrate exited") {
+		t.Fatalf("expected migrate to fail, got %v", err)
+	}
+	if !strings.Contains(out, "migrating") || strings.Contains(out, "api") {
+		t.Fatalf("expected only migrate to run, got %q", out)
+	}
+	if code, _ := pm.ExitCode("migrate"); code != 2 {
+		t.Fatalf("got exit code %d, want 2", code)
+	}
+	if err := pm.RunOnce("nope"); !errors.Is(err, ErrProcessNotFound) {
+		t.Fatalf("expected ErrProcessNotFound, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	captureStdout(func() { err = pm.RunOnceContext(ctx, "hang") })
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Fatalf("expected hang to be interrupted, got %v after %v", err, time.Since(start))
+	}
+
+	// Everything runs again afterwards, including processes already run.
+	out, _ = captureStdout(pm.Run)
+	if !strings.Contains(out, "migrating") || !strings.Contains(out, "api") {
+		t.Fatalf("expected all processes to run, got %q", out)
+	}
+}
+
+func TestSignalExited(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{Cmds: []string{"true"}, Silent: true})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+	out, err := captureStdout(func() { pm.procs[0].signal(syscall.SIGTERM) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Fatalf("expected signalling an exited process to write nothing, got %q", out)
+	}
+}
+
+func TestPassthroughSignals(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Cmds:               []string{"trap 'echo got usr1' USR1; while true; do sleep 0.05; done"},
+		PassthroughSignals: []os.Signal{syscall.SIGUSR1},
+		Silent:             true,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	}()
+	out, err := captureStdout(func() { pm.run(ctx) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "got usr1") {
+		t.Fatalf("expected signal to be passed through, got %q", out)
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, PassthroughSignals: []os.Signal{syscall.SIGINT}}); err == nil {
+		t.Fatal("expected an error for passing through SIGINT")
+	}
+}
+
+func TestReload(t *testing.T) {
+	ansi.NoColor = true
+	cfg := Config{Processes: []ProcessConfig{
+		{Name: "api", Cmd: "echo api-v1 && sleep 5"},
+		{Name: "web", Cmd: "echo web-v1 && sleep 5"},
+		{Name: "css", Cmd: "echo css-v1 && sleep 5"},
+	}}
+	pm := MustNew(cfg)
+	logDir := filepath.Join(t.TempDir(), "logs")
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	out, err := captureStdout(func() {
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			next := cfg
+			next.LogDir = logDir
+			next.Processes = []ProcessConfig{
+				{Name: "api", Cmd: "echo api-v2 && sleep 5"},
+				{Name: "web", Cmd: "echo web-v1 && sleep 5"},
+				{Name: "worker", Cmd: "echo worker-started && sleep 0.3 && echo worker-still-running && sleep 5"},
+			}
+			if err := pm.Reload(next); err != nil {
+				t.Error(err)
+			}
+		}()
+		pm.run(ctx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Removing css doesn't shut down everything else, like it exiting on
+	// its own would.
+	for _, want := range []string{
+		"Config changed, restarting...", "api-v2",
+		"css     Removed from config, stopping...",
+		"worker  worker-started", "worker  worker-still-running",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out)
+		}
+	}
+	if strings.Count(out, "web  web-v1\n") != 1 {
+		t.Fatalf("expected unchanged process to keep running, got %q", out)
+	}
+	// Reloading only reads commands from the config, without setting up
+	// anything else.
+	if _, err := os.Stat(logDir); !os.IsNotExist(err) {
+		t.Fatalf("expected reloading not to create the log directory, got %v", err)
+	}
+
+	// Once shutting down, nothing is applied and the caller is told why.
+	pm = MustNew(cfg)
+	pm.running = true
+	pm.shutdown = make(chan struct{})
+	close(pm.shutdown)
+	next := cfg
+	next.Processes = []ProcessConfig{{Name: "api", Cmd: "echo api-v2"}, {Name: "worker", Cmd: "true"}}
+	if err := pm.Reload(next); err == nil {
+		t.Fatal("expected an error reloading while shutting down")
+	}
+	if names := pm.Names(); !reflect.DeepEqual(names, []string{"api", "web", "css"}) {
+		t.Fatalf("expected processes to be left as they were, got %v", names)
+	}
+	if proc, _ := pm.process("api"); proc.next != nil {
+		t.Fatal("expected api's command not to be changed")
+	}
+}
+
+func TestRestartRateLimit(t *testing.T) {
+	pm := &ProcessManager{restartWindow: time.Minute, maxWindowRestarts: 2}
+	now := time.Now()
+	times := []time.Time{now.Add(-2 * time.Minute), now.Add(-30 * time.Second)}
+	times, ok := pm.allowRestart(times, now)
+	if !ok || len(times) != 2 {
+		t.Fatalf("allowRestart() = %v, %v, want the old restart dropped and this one allowed", times, ok)
+	}
+	if _, ok := pm.allowRestart(times, now.Add(time.Second)); ok {
+		t.Fatal("allowRestart() allowed a third restart within the window")
+	}
+
+	ansi.NoColor = true
+	pm = MustNew(Config{
+		Processes:            []ProcessConfig{{Name: "crash", Cmd: "echo crashing && sleep 0.1 && exit 1", RestartDelay: 10 * time.Millisecond}},
+		RestartOnError:       true,
+		MaxRestartWindow:     time.Minute,
+		MaxRestartsPerWindow: 2,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := captureStdout(func() { pm.run(ctx) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out, "crash  crashing"); n != 3 {
+		t.Fatalf("expected the process to run 3 times, ran %d: %q", n, out)
+	}
+	if !strings.Contains(out, "Restart rate limit exceeded (2 in 1m0s), giving up") {
+		t.Fatalf("expected rate limit message, got %q", out)
+	}
+	if !strings.Contains(out, "Restarting... (restart 2)") {
+		t.Fatalf("expected restart messages to be counted, got %q", out)
+	}
+	if got := pm.Results()[0].Restarts; got != 2 {
+		t.Fatalf("Results() restarts = %d, want 2", got)
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, MaxRestartWindow: time.Minute}); err == nil {
+		t.Fatal("expected an error for MaxRestartWindow without MaxRestartsPerWindow")
+	}
+}
+
+func TestNewWithWriter(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Cmds:      []string{"echo hello && sleep 0.1"},
+		OnAllExit: "echo all done",
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Fatalf("expected nothing written to stdout, got %q", out)
+	}
+	for _, want := range []string{"echo  hello\n", "all done\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected output to contain %q, got %q", want, buf.String())
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "a", Cmd: "sleep 0.1"},
+			{Name: "b", Cmd: "sleep 0.7"},
+		},
+		HeartbeatInterval: 300 * time.Millisecond,
+		NoAutoExit:        true,
+		Silent:            true,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	out, err := captureStdout(func() { pm.run(ctx) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "[heartbeat] running: b | stopped: a (exit 0)\n") {
+		t.Fatalf("expected a heartbeat line, got %q", out)
+	}
+	if strings.Contains(out, "[heartbeat] stopped:") {
+		t.Fatalf("expected heartbeats to stop once every process exited, got %q", out)
+	}
+}
+
+// runInBackground runs pm until ctx is done or its processes exit, and
+// waits for it to return once the test ends, so no output from it is written
+// during later tests.
+func runInBackground(t *testing.T, ctx context.Context, pm *ProcessManager) {
+	done := make(chan struct{})
+	go func() {
+		pm.run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() { <-done })
+}
+
+func TestMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	pm, err := NewWithWriter(Config{
+		Processes:       []ProcessConfig{{Name: "api", Cmd: "sleep 1"}},
+		MetricsAddr:     addr,
+		MetricsInterval: 50 * time.Millisecond,
+		Silent:          true,
+	}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	runInBackground(t, ctx, pm)
+	time.Sleep(300 * time.Millisecond)
+
+	res, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+	if !strings.Contains(body, `tandem_process_cpu_seconds_total{name="api"} `) {
+		t.Fatalf("expected CPU usage for api, got %q", body)
+	}
+	if !strings.Contains(body, `tandem_process_rss_bytes{name="api"} `) || strings.Contains(body, `tandem_process_rss_bytes{name="api"} 0\n`) {
+		t.Fatalf("expected memory usage for api, got %q", body)
+	}
+}
+
+func TestMetricsExited(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	proc := &process{Cmd: cmd, Name: "once", pid: cmd.Process.Pid, state: cmd.ProcessState}
+	pm := &ProcessManager{procs: []*process{proc}}
+	pm.sampleUsage()
+	if proc.usage.rssBytes != 0 {
+		t.Fatalf("expected no memory for an exited process, got %d", proc.usage.rssBytes)
+	}
+	if proc.usage.cpuSeconds <= 0 {
+		t.Fatalf("expected CPU time for an exited process, got %g", proc.usage.cpuSeconds)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "stuck", Cmd: "echo stuck-started && sleep 5"},
+			{Name: "ticker", Cmd: "echo ticker-started && while true; do echo tick; sleep 0.05; done"},
+		},
+		WatchdogTimeout: 300 * time.Millisecond,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	pm.run(ctx)
+
+	out := buf.String()
+	if !strings.Contains(out, "stuck   No output for 300ms, restarting...") {
+		t.Fatalf("expected stuck to be restarted, got %q", out)
+	}
+	if n := strings.Count(out, "stuck   stuck-started"); n < 2 {
+		t.Fatalf("expected stuck to start again after the watchdog restarted it, started %d times in %q", n, out)
+	}
+	if strings.Contains(out, "ticker  No output") || strings.Count(out, "ticker  ticker-started") != 1 {
+		t.Fatalf("expected ticker to keep running, got %q", out)
+	}
+
+	// Lines tandem writes about a process aren't output from it, so they
+	// don't hold off the watchdog.
+	proc := pm.processes()[0]
+	proc.mu.Lock()
+	proc.lastOutputAt = time.Now().Add(-time.Minute)
+	proc.mu.Unlock()
+	proc.writeDebug("Starting...")
+	if proc.idleFor() < time.Minute {
+		t.Fatal("expected tandem's own lines not to count as output")
+	}
+	pm.output.countOutput(proc, []byte("real output"))
+	if proc.idleFor() >= time.Minute {
+		t.Fatal("expected output from the process to count")
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	pm, err := New(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "true"},
+			{Name: "css", Cmd: "true"},
+			{Name: "web", Cmd: "true"},
+		},
+		Timeout:  5,
+		Timeouts: map[string]int{"api": 30, "css": 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want time.Duration
+	}{
+		{"api", 30 * time.Second},
+		{"css", 0},
+		{"web", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		proc, err := pm.process(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proc.timeout != tt.want {
+			t.Errorf("got timeout %v for %s, want %v", proc.timeout, tt.name, tt.want)
+		}
+	}
+
+	if err := (Config{Cmds: []string{"true"}, Timeouts: map[string]int{"true": -1}}).Validate(); err == nil {
+		t.Error("Validate: expected error for a negative timeout")
+	}
+	if _, err := New(Config{Cmds: []string{"true"}, Timeouts: map[string]int{"nope": 1}}); err == nil {
+		t.Error("New: expected error for a timeout for an unknown process")
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	exited := func(command string) *exec.Cmd {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Run()
+		return cmd
+	}
+	clean, failed := exited("exit 0"), exited("exit 1")
+	tests := []struct {
+		name        string
+		onError     bool
+		onCleanExit bool
+		procRestart bool
+		maxRestarts int
+		restarts    int
+		cmd         *exec.Cmd
+		want        bool
+	}{
+		{"no flags, failed", false, false, false, 0, 0, failed, false},
+		{"no flags, clean", false, false, false, 0, 0, clean, false},
+		{"restart on error, failed", true, false, false, 0, 0, failed, true},
+		{"restart on error, clean", true, false, false, 0, 0, clean, false},
+		{"restart on clean exit, clean", false, true, false, 0, 0, clean, true},
+		{"restart on clean exit, failed", false, true, false, 0, 0, failed, false},
+		{"both, failed", true, true, false, 0, 0, failed, true},
+		{"both, clean", true, true, false, 0, 0, clean, true},
+		{"process restart, failed", false, false, true, 0, 0, failed, true},
+		{"process restart, clean", false, false, true, 0, 0, clean, false},
+		{"under max restarts", true, true, false, 3, 2, failed, true},
+		{"at max restarts", true, true, false, 3, 3, clean, false},
+	}
+	for _, tt := range tests {
+		pm := &ProcessManager{restartOnError: tt.onError, restartOnCleanExit: tt.onCleanExit}
+		proc := &process{Cmd: tt.cmd, pid: tt.cmd.Process.Pid, state: tt.cmd.ProcessState, restart: tt.procRestart, maxRestarts: tt.maxRestarts}
+		if got := pm.shouldRestart(proc, tt.restarts); got != tt.want {
+			t.Errorf("%s: shouldRestart() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSeparateStderr(t *testing.T) {
+	ansi.NoColor = false
+	defer func() { ansi.NoColor = true }()
+	tests := []struct {
+		separate bool
+		wantRed  bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		pm, err := NewWithWriter(Config{
+			Cmds:           []string{"echo to-stdout && echo to-stderr >&2 && sleep 0.1"},
+			SeparateStderr: tt.separate,
+			Silent:         true,
+		}, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.run(context.Background())
+		out := buf.String()
+		if !strings.Contains(out, "to-stdout") || !strings.Contains(out, "to-stderr") {
+			t.Fatalf("SeparateStderr %v: expected both lines, got %q", tt.separate, out)
+		}
+		if got := strings.Contains(out, ansi.Red("to-stderr")); got != tt.wantRed {
+			t.Errorf("SeparateStderr %v: got stderr in red %v, want %v, in %q", tt.separate, got, tt.wantRed, out)
+		}
+		if strings.Contains(out, ansi.Red("to-stdout")) {
+			t.Errorf("SeparateStderr %v: expected stdout not to be red, got %q", tt.separate, out)
+		}
+	}
+}
+
+func TestBanner(t *testing.T) {
+	ansi.NoColor = true
+	banner := "api  echo api-out\nweb  echo web-out\n\n"
+	tests := []struct {
+		silent   bool
+		noBanner bool
+		want     bool
+	}{
+		{false, false, true},
+		{false, true, false},
+		{true, false, false},
+		{true, true, false},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		pm, err := NewWithWriter(Config{
+			Processes: []ProcessConfig{{Name: "api", Cmd: "echo api-out"}, {Name: "web", Cmd: "echo web-out"}},
+			Silent:    tt.silent,
+			NoBanner:  tt.noBanner,
+		}, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.run(context.Background())
+		out := buf.String()
+		if got := strings.HasPrefix(out, banner); got != tt.want {
+			t.Errorf("Silent %v, NoBanner %v: got banner %v, want %v, in %q", tt.silent, tt.noBanner, got, tt.want, out)
+		}
+		if !tt.want && strings.Contains(out, "echo api-out") {
+			t.Errorf("Silent %v, NoBanner %v: expected no banner, got %q", tt.silent, tt.noBanner, out)
+		}
+	}
+}
+
+func TestColorForName(t *testing.T) {
+	palette := []int{10, 20, 30, 40, 50}
+	tests := []struct {
+		name string
+		want int
+	}{
+		// FNV-1a hashes of each name, modulo the palette's length.
+		{"api", 30},
+		{"web", 10},
+		{"css", 30},
+		{"worker", 30},
+		{"", 20},
+	}
+	for _, tt := range tests {
+		if got := colorForName(tt.name, palette); got != tt.want {
+			t.Errorf("colorForName(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// Colors don't depend on where a process is in the list.
+	colorsOf := func(procs []ProcessConfig) map[string]int {
+		pm, err := New(Config{Processes: procs, ColorByHash: true, Colors: palette})
+		if err != nil {
+			t.Fatal(err)
+		}
+		colors := map[string]int{}
+		for _, proc := range pm.processes() {
+			colors[proc.Name] = proc.Color
+		}
+		return colors
+	}
+	api, web := ProcessConfig{Name: "api", Cmd: "true"}, ProcessConfig{Name: "web", Cmd: "true"}
+	if a, b := colorsOf([]ProcessConfig{api, web}), colorsOf([]ProcessConfig{web, api}); !reflect.DeepEqual(a, b) {
+		t.Errorf("got colors %v and %v for the same processes in a different order", a, b)
+	}
+}
+
+func TestShutdownQueuedExits(t *testing.T) {
+	pm := &ProcessManager{
+		done:         make(chan *process, 3),
+		shutdown:     make(chan struct{}),
+		shutdownOnce: new(sync.Once),
+	}
+	pm.done <- &process{Name: "a"}
+	pm.done <- &process{Name: "b"}
+	pm.drainDone()
+	if n := len(pm.done); n != 0 {
+		t.Fatalf("expected queued exits to be drained, %d left", n)
+	}
+	pm.beginShutdown()
+	pm.beginShutdown()
+	if !pm.shuttingDown() {
+		t.Fatal("expected to be shutting down")
+	}
+}
+
+func TestExitCodeFile(t *testing.T) {
+	ansi.NoColor = true
+	path := filepath.Join(t.TempDir(), "exitcode")
+	readCode := func() string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	pm := MustNew(Config{Cmds: []string{"sleep 0.1 && exit 3", "sleep 5"}, ExitCodeFile: path, Silent: true})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCode(); got != "3\n" {
+		t.Fatalf("got exit code %q after a failure, want 3", got)
+	}
+	if got := pm.RunExitCode(); got != 3 {
+		t.Fatalf("RunExitCode() = %d after a failure, want 3", got)
+	}
+
+	pm = MustNew(Config{Cmds: []string{"sleep 5"}, ExitCodeFile: path, Silent: true})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCode(); got != "130\n" {
+		t.Fatalf("got exit code %q after an interrupt, want 130", got)
+	}
+	if got := pm.RunExitCode(); got != 130 {
+		t.Fatalf("RunExitCode() = %d after an interrupt, want 130", got)
+	}
+}
+
+func TestRunPipe(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{Cmds: []string{"echo first && sleep 0.1"}, Silent: true})
+	r, w := io.Pipe()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "# a comment\n\necho second && sleep 0.3\n")
+		io.WriteString(w, "echo third && sleep 0.1\n")
+		w.Close()
+	}()
+	out, err := captureStdout(func() { pm.RunPipe(r) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"echo  first\n", "echo.2  second\n", "echo.3  third\n"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out)
+		}
+	}
+	if strings.Contains(out, "comment") {
+		t.Fatalf("expected comments to be skipped, got %q", out)
+	}
+	if names := pm.Names(); len(names) != 3 {
+		t.Fatalf("got processes %q, want 3", names)
+	}
+
+	// Interrupting stops piped processes without waiting for more input.
+	pm = MustNew(Config{Silent: true})
+	r, w = io.Pipe()
+	defer w.Close()
+	go func() {
+		io.WriteString(w, "sleep 5\n")
+		time.Sleep(300 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	done := make(chan struct{})
+	go func() {
+		captureStdout(func() { pm.RunPipe(r) })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("RunPipe didn't return after being interrupted")
+	}
+}
+
+func TestShell(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{Cmds: []string{"echo shell=$0 && sleep 0.1"}, Shell: "/bin/bash", Silent: true})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "shell=/bin/bash") {
+		t.Fatalf("expected command to run with bash, got %q", out)
+	}
+}
+
+func TestResults(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Cmds:   []string{"printf 'a\\nbc\\n' && sleep 0.1 && exit 2"},
+		Silent: true,
+	})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, err := pm.ExitCode("printf"); err != nil || code != 2 {
+		t.Fatalf("ExitCode() = %v, %v, want 2", code, err)
+	}
+	if _, err := pm.ExitCode("nope"); !errors.Is(err, ErrProcessNotFound) {
+		t.Fatalf("ExitCode() for unknown process: got error %v, want ErrProcessNotFound", err)
+	}
+
+	got := pm.Results()
+	want := []ProcessResult{{Name: "printf", ExitCode: 2, LinesWritten: 2, BytesWritten: 3}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Results() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{Cmds: []string{"sleep 0.5"}})
+	if err := pm.Pause("sleep"); err == nil {
+		t.Fatal("Pause: expected error before the process is running")
+	}
+	if err := pm.Pause("nope"); err == nil {
+		t.Fatal("Pause: expected error for unknown process")
+	}
+
+	out, err := captureStdout(func() {
+		go func() {
+			for !pm.procs[0].Running() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err := pm.Pause("sleep"); err != nil {
+				t.Error(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if err := pm.Resume("sleep"); err != nil {
+				t.Error(err)
+			}
+		}()
+		pm.Run()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Paused") || !strings.Contains(out, "Resumed") {
+		t.Fatalf("expected output to contain pause messages, got %q", out)
+	}
+}
+
+func TestInjectPackageVersion(t *testing.T) {
+	ansi.NoColor = true
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "package.json"), []byte(`{"version": "1.2.3"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pm := MustNew(Config{
+		Root:                 root,
+		Cmds:                 []string{"echo version=$APP_VERSION && sleep 0.1"},
+		InjectPackageVersion: true,
+		NoPackageJSONWalk:    true,
+		Silent:               true,
+		OnAllExit:            "echo on-exit=$APP_VERSION",
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"version=1.2.3", "on-exit=1.2.3"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out)
+		}
+	}
+}
+
+func TestDirs(t *testing.T) {
+	ansi.NoColor = true
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pm := MustNew(Config{
+		Root:   root,
+		Cmds:   []string{"echo dir=$(basename $(pwd)) && sleep 0.1"},
+		Dirs:   map[string]string{"echo": "api"},
+		Silent: true,
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "dir=api") {
+		t.Fatalf("expected command to run in api directory, got %q", out)
+	}
+
+	_, err = New(Config{Root: root, Cmds: []string{"true"}, Dirs: map[string]string{"nope": "api"}})
+	if err == nil || !strings.Contains(err.Error(), `directory given for unknown process "nope"`) {
+		t.Fatalf("expected an unknown process error, got %v", err)
+	}
+}
+
+func TestPorts(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "echo api=$PORT && sleep 0.1"},
+			{Name: "web", Cmd: "echo web=$PORT && sleep 0.1"},
+		},
+		Ports:  map[string]int{"api": 3001, "web": 3002},
+		Silent: true,
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "api=3001") || !strings.Contains(out, "web=3002") {
+		t.Fatalf("expected output to contain ports, got %q", out)
+	}
+
+	tests := []struct {
+		ports map[string]int
+		want  string
+	}{
+		{map[string]int{"api": 3000, "web": 3000}, `port 3000 given to both "api" and "web"`},
+		{map[string]int{"api": 70000}, `invalid port 70000 for "api"`},
+		{map[string]int{"nope": 3000}, `port given for unknown process "nope"`},
+	}
+	for _, tt := range tests {
+		_, err := New(Config{
+			Processes: []ProcessConfig{{Name: "api", Cmd: "true"}, {Name: "web", Cmd: "true"}},
+			Ports:     tt.ports,
+		})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("New(%v): got error %v, want %q", tt.ports, err, tt.want)
+		}
+	}
+}
+
+func TestReadyString(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "sleep 0.1 && echo 'Listening on port 3000' && sleep 0.3"},
+			{Name: "web", Cmd: "sleep 0.3"},
+		},
+		ReadyStrings: map[string]string{"api": "Listening on"},
+	})
+	ready, err := pm.Ready("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notReady, err := pm.Ready("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ready:
+	default:
+		t.Fatal("expected api to become ready")
+	}
+	if !strings.Contains(out, "api  Ready") {
+		t.Fatalf("expected output to contain ready message, got %q", out)
+	}
+	select {
+	case <-notReady:
+		t.Fatal("expected web to never become ready")
+	default:
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, ReadyStrings: map[string]string{"nope": "x"}}); err == nil {
+		t.Fatal("New: expected error for unknown process")
+	}
+}
+
+func TestReadyPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	pm := MustNew(Config{
+		Processes:  []ProcessConfig{{Name: "api", Cmd: "sleep 0.3"}},
+		ReadyPorts: map[string]int{"api": port},
+		Silent:     true,
+	})
+	ready, err := pm.Ready("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ready:
+	default:
+		t.Fatal("expected api to become ready")
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, ReadyPorts: map[string]int{"true": 0}}); err == nil {
+		t.Fatal("New: expected error for invalid port")
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "echo api && sleep 0.6"},
+			{Name: "web", Cmd: "sleep 0.2 && echo web && sleep 0.4"},
+			{Name: "worker", Cmd: "sleep 0.6"},
+		},
+		Silent: true,
+	}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	runInBackground(t, ctx, pm)
+
+	// worker never writes anything, so it's never ready.
+	waitCtx, waitCancel := context.WithTimeout(ctx, 400*time.Millisecond)
+	defer waitCancel()
+	if err := pm.WaitForReady(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForReady: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	for _, name := range []string{"api", "web"} {
+		proc, _ := pm.process(name)
+		select {
+		case <-proc.firstOutput:
+		default:
+			t.Fatalf("expected %s to have written output", name)
+		}
+	}
+
+	pm, err = NewWithWriter(Config{Cmds: []string{"sleep 0.1 && echo a && sleep 0.2", "echo b && sleep 0.3"}, Silent: true}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runInBackground(t, ctx, pm)
+	if err := pm.WaitForReady(ctx); err != nil {
+		t.Fatalf("WaitForReady: %v", err)
+	}
+
+	// tandem's own messages, like "Starting...", aren't output from the
+	// process, so they don't count.
+	pm, err = NewWithWriter(Config{Cmds: []string{"sleep 1"}}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runInBackground(t, ctx, pm)
+	waitCtx, waitCancel = context.WithTimeout(ctx, 300*time.Millisecond)
+	defer waitCancel()
+	if err := pm.WaitForReady(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForReady without output: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStdinBroadcast(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "a", Cmd: "echo ready && read line && echo \"a got $line\" && sleep 0.3"},
+			{Name: "b", Cmd: "echo ready && read line && echo \"b got $line\" && sleep 0.3"},
+		},
+		Silent: true,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		pm.run(ctx)
+		close(done)
+	}()
+	if err := pm.WaitForReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pm.forwardInput(strings.NewReader("r\n"), pm.processes())
+	<-done
+
+	for _, want := range []string{"a got r", "b got r"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected output to contain %q, got %q", want, buf.String())
+		}
+	}
+
+	if _, err := New(Config{Cmds: []string{"true"}, StdinProcess: "true", StdinBroadcast: true}); err == nil {
+		t.Fatal("New: expected error for StdinProcess with StdinBroadcast")
+	}
+}
+
+func TestStdinDropsForSlowProcess(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{Processes: []ProcessConfig{{Name: "slow", Cmd: "true"}}}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := pm.processes()[0]
+	// Nothing reads from the pipe until input has been dropped, so writes to
+	// it block once its buffer fills.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	pm.output.pipe(proc).pty = w
+
+	chunk := strings.Repeat("x", 4095) + "\n"
+	input := &eofReader{r: strings.NewReader(strings.Repeat(chunk, 200)), eof: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		pm.forwardInput(input, []*process{proc})
+		close(done)
+	}()
+	select {
+	case <-input.eof:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwardInput was held up by a process that isn't reading its input")
+	}
+	go io.Copy(io.Discard, r)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwardInput didn't finish")
+	}
+	if n := strings.Count(buf.String(), "dropping input"); n != 1 {
+		t.Fatalf("expected dropped input to be reported once, got %d in %q", n, buf.String())
+	}
+}
+
+func TestPrependNameToStdin(t *testing.T) {
+	ansi.NoColor = true
+	tests := []struct {
+		echo  bool
+		input string
+		want  string
+	}{
+		{false, "first\n", ""},
+		{true, "first\n", "api  first\n"},
+		{true, "first\r\nsecond\n", "api  first\napi  second\n"},
+		{true, "partial", "api  partial\n"},
+		{true, "", ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		pm, err := NewWithWriter(Config{
+			Processes:          []ProcessConfig{{Name: "api", Cmd: "true"}},
+			StdinProcess:       "api",
+			PrependNameToStdin: tt.echo,
+		}, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The process isn't running, so input to it is dropped, but it's
+		// still echoed.
+		pm.forwardInput(strings.NewReader(tt.input), pm.processes())
+		if got := buf.String(); got != tt.want {
+			t.Errorf("PrependNameToStdin %v with input %q: got %q, want %q", tt.echo, tt.input, got, tt.want)
+		}
+	}
+}
+
+// eofReader closes eof once r has been read to the end.
+type eofReader struct {
+	r   io.Reader
+	eof chan struct{}
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		close(r.eof)
+	}
+	return n, err
+}
+
+func TestNoInheritEnv(t *testing.T) {
+	ansi.NoColor = true
+	t.Setenv("TANDEM_TEST_VAR", "inherited")
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{{
+			Name: "env",
+			Cmd:  "echo \"[$TANDEM_TEST_VAR] [$OWN] [${PATH:+path}]\" && sleep 0.1",
+			Env:  map[string]string{"OWN": "own"},
+		}},
+		NoInheritEnv: true,
+		Silent:       true,
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "[] [own] [path]") {
+		t.Fatalf("expected only PATH and own variables, got %q", out)
+	}
+}
+
+func TestKillTimeout(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "server", Cmd: "trap '' INT; trap 'exit 0' TERM; while true; do sleep 0.05; done"},
+			{Name: "quick", Cmd: "sleep 0.1"},
+		},
+		KillTimeout: 2,
+	})
+	start := time.Now()
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "server  Terminating...") || strings.Contains(out, "Killing...") {
+		t.Fatalf("expected server to be terminated but not killed, got %q", out)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected server to exit after SIGTERM, took %v", elapsed)
+	}
+}
+
+func TestSignalGroup(t *testing.T) {
+	ansi.NoColor = true
+	trap := "trap 'echo got-usr1' USR1; echo started; while true; do sleep 0.05; done"
+	pm := MustNew(Config{
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: trap, Groups: []string{"backend"}},
+			{Name: "worker", Cmd: trap},
+			{Name: "web", Cmd: trap},
+		},
+		Groups: map[string][]string{"backend": {"worker"}},
+	})
+	if err := pm.SignalGroup("nope", syscall.SIGUSR1); err == nil {
+		t.Fatal("SignalGroup: expected error for unknown group")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	out, err := captureStdout(func() {
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			if err := pm.SignalGroup("backend", syscall.SIGUSR1); err != nil {
+				t.Error(err)
+			}
+		}()
+		pm.run(ctx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"api     got-usr1", "worker  got-usr1"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out)
+		}
+	}
+	if strings.Contains(out, "web     got-usr1") {
+		t.Fatalf("expected web not to be signalled, got %q", out)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "web", Cmd: "echo web-started && sleep 0.1", WaitFor: []string{"api", "db"}},
+			{Name: "api", Cmd: "sleep 0.2 && echo listening && sleep 0.3"},
+			{Name: "db", Cmd: "echo db-up && sleep 0.5"},
+		},
+		ReadyStrings: map[string]string{"api": "listening"},
+		NoAutoExit:   true,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 800*time.Millisecond)
+	defer cancel()
+	pm.run(ctx)
+	out := buf.String()
+	waiting, ready, started := strings.Index(out, "web  Waiting for api..."), strings.Index(out, "api  listening"), strings.Index(out, "web  web-started")
+	if waiting < 0 || ready < 0 || started < 0 || !(waiting < ready && ready < started) {
+		t.Fatalf("expected web to wait for api to be ready before starting, got %q", out)
+	}
+
+	for _, tt := range []struct {
+		procs []ProcessConfig
+		want  string
+	}{
+		{[]ProcessConfig{{Name: "web", Cmd: "true", WaitFor: []string{"nope"}}}, `process "web" waits for unknown process "nope"`},
+		{[]ProcessConfig{
+			{Name: "a", Cmd: "true", WaitFor: []string{"b"}},
+			{Name: "b", Cmd: "true", WaitFor: []string{"a"}},
+		}, "processes wait for each other: a -> b -> a"},
+		{[]ProcessConfig{{Name: "a", Cmd: "true", WaitFor: []string{"a"}}}, "processes wait for each other: a -> a"},
+	} {
+		if _, err := New(Config{Processes: tt.procs}); err == nil || err.Error() != tt.want {
+			t.Errorf("New: got error %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestWatchGlobs(t *testing.T) {
+	ansi.NoColor = true
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Root: dir,
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "echo api-started && sleep 5", WatchGlobs: []string{"*.go"}},
+		},
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		pm.run(ctx)
+		close(done)
+	}()
+	time.Sleep(watchInterval + 100*time.Millisecond)
+	// Files that don't match aren't watched.
+	if err := os.WriteFile(filepath.Join(dir, "readme.md"), []byte("hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(watchInterval + 100*time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "server.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(watchInterval + 300*time.Millisecond)
+	cancel()
+	<-done
+	out := buf.String()
+	if strings.Count(out, "api  Files changed, restarting...") != 1 || strings.Count(out, "api  api-started") != 2 {
+		t.Fatalf("expected api to be restarted once when a .go file was added, got %q", out)
+	}
+
+	if _, err := New(Config{Processes: []ProcessConfig{{Name: "api", Cmd: "true", WatchGlobs: []string{"[*.go"}}}}); err == nil {
+		t.Error("New: expected error for an invalid watch pattern")
+	}
+}
+
+func TestOutputBeforeExit(t *testing.T) {
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{
+			{Name: "a", Cmd: "echo a-done"},
+			{Name: "b", Cmd: "echo b-done"},
+			{Name: "c", Cmd: "echo c-done"},
+			// Something left running in the background keeps the terminal
+			// open, which shouldn't hold up tandem.
+			{Name: "bg", Cmd: "sleep 5 & echo bg-done"},
+		},
+		NoAutoExit: true,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	pm.run(ctx)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected tandem not to wait for background commands, took %v", elapsed)
+	}
+	out := buf.String()
+	for _, want := range []string{"a   a-done", "b   b-done", "c   c-done", "bg  bg-done"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output written just before exiting to be shown, missing %q in %q", want, out)
+		}
+	}
+}
+
+func TestMaxOutputRate(t *testing.T) {
+	ansi.NoColor = true
+	pm := MustNew(Config{
+		Cmds:          []string{"seq 1 100 && sleep 0.1"},
+		MaxOutputRate: 10,
+		Silent:        true,
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "seq  10\n") || strings.Contains(out, "seq  11\n") {
+		t.Fatalf("expected only the first 10 lines, got %q", out)
+	}
+	if !strings.Contains(out, "[90 lines dropped]") {
+		t.Fatalf("expected dropped lines to be reported, got %q", out)
+	}
+}
+
+func TestOnAllExit(t *testing.T) {
+	root := t.TempDir()
+	pm := MustNew(Config{
+		Root:      root,
+		Cmds:      []string{"sleep 0.1"},
+		OnAllExit: "echo cleaned > cleanup.txt",
+		Silent:    true,
+	})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, "cleanup.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "cleaned\n" {
+		t.Fatalf("unexpected cleanup output %q", b)
+	}
+}
+
+func TestOnAllExitFailure(t *testing.T) {
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Cmds:      []string{"true"},
+		OnAllExit: "echo oops >&2; exit 2",
+		Silent:    true,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.run(context.Background())
+	for _, want := range []string{"oops\n", "tandem: on-all-exit command failed: exit status 2\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected output to contain %q, got %q", want, buf.String())
+		}
+	}
+}
+
+func TestOnFirstExit(t *testing.T) {
+	root := t.TempDir()
+	pm := MustNew(Config{
+		Root: root,
+		Processes: []ProcessConfig{
+			{Name: "quick", Cmd: "sleep 0.1 && exit 3"},
+			{Name: "slow", Cmd: "sleep 1"},
+		},
+		OnFirstExit: `echo "$TANDEM_PROC_NAME $TANDEM_EXIT_CODE" >> first.txt`,
+		Silent:      true,
+	})
+	if _, err := captureStdout(pm.Run); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, "first.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "quick 3\n" {
+		t.Fatalf("unexpected on-first-exit output %q", b)
+	}
+}
+
+func TestPreStartHook(t *testing.T) {
+	ansi.NoColor = true
+	var called []string
+	out, err := captureStdout(func() {
+		pm, err := New(Config{
+			Cmds:   []string{"echo 'hello'"},
 			Silent: true,
+			PreStartHook: func(name, cmd string) error {
+				called = append(called, name+"="+cmd)
+				return errors.New("not ready")
+			},
 		})
 		if err != nil {
 			t.Fatal(err)
@@ -28,10 +1544,41 @@ func TestGoAPI(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	hasCmd1 := strings.Contains(out, "echo.1  hello")
-	hasCmd2 := strings.Contains(out, "echo.2  world")
-	if !hasCmd1 || !hasCmd2 {
-		t.Fatalf("expected output to contain both commands, got %q", out)
+	if want := []string{"echo=echo 'hello'"}; !slices.Equal(called, want) {
+		t.Fatalf("expected hook to be called with %v, got %v", want, called)
+	}
+	if strings.Contains(out, "hello") || !strings.Contains(out, "not ready") {
+		t.Fatalf("expected process not to start, got %q", out)
+	}
+}
+
+func TestPostExitHook(t *testing.T) {
+	ansi.NoColor = true
+	var mu sync.Mutex
+	codes := map[string]int{}
+	_, err := captureStdout(func() {
+		pm, err := New(Config{
+			Cmds:   []string{"true", "sleep 0.1 && exit 3"},
+			Silent: true,
+			PostExitHook: func(name string, exitCode int) {
+				mu.Lock()
+				defer mu.Unlock()
+				codes[name] = exitCode
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.Run()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if codes["true"] != 0 || codes["sleep"] == 0 {
+		t.Fatalf("expected exit codes for both commands, got %v", codes)
 	}
 }
 
@@ -39,6 +1586,8 @@ func TestParseNpmScripts(t *testing.T) {
 	pkg := []byte(`
 		{
 			"scripts": {
+				"//": "comment keys are skipped by wildcards",
+				"//dev:css": "builds styles",
 				"dev:css": "echo 'css'",
 				"dev:js": "echo 'js'",
 				"test": "echo 'test'"
@@ -83,7 +1632,7 @@ func TestParseNpmScripts(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		cmds, err := parseNpmScripts(pkg, tt.cmds)
+		cmds, err := parseNpmScripts(pkg, tt.cmds, nil, nil)
 		if (err != nil) != tt.wantErr {
 			t.Fatalf("parseNpmScripts(%q): got error %v, want error %v", tt.cmds, err, tt.wantErr)
 		}
@@ -97,6 +1646,35 @@ func TestParseNpmScripts(t *testing.T) {
 			t.Fatalf("parseNpmScripts(%q): got %v, want %v", tt.cmds, got, tt.want)
 		}
 	}
+
+	// Wildcards only match allowed scripts, but exact names always match.
+	cmds, err := parseNpmScripts(pkg, []string{"npm:dev:*", "npm:test"}, []string{"dev:js"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 || cmds[0].name != "dev:js" || cmds[1].name != "test" {
+		t.Fatalf("parseNpmScripts with allowed scripts: got %+v", cmds)
+	}
+}
+
+func TestScriptCommand(t *testing.T) {
+	tests := []struct {
+		script, cmd string
+		wantName    string
+		wantCmd     string
+	}{
+		{"dev:css", "postcss -w", "dev:css", "postcss -w"},
+		{"dev:css", "# tandem:name=css\npostcss -w", "css", "postcss -w"},
+		{"dev:css", "/* tandem:name=css */ postcss -w", "css", "postcss -w"},
+		{"dev:css", "# just a comment\npostcss -w", "dev:css", "# just a comment\npostcss -w"},
+		{"dev:css", "/* tandem:name= */ postcss -w", "dev:css", "/* tandem:name= */ postcss -w"},
+	}
+	for _, tt := range tests {
+		got := scriptCommand(tt.script, tt.cmd)
+		if got.name != tt.wantName || got.cmd != tt.wantCmd || got.script != tt.script {
+			t.Errorf("scriptCommand(%q, %q) = %q, %q, want %q, %q", tt.script, tt.cmd, got.name, got.cmd, tt.wantName, tt.wantCmd)
+		}
+	}
 }
 
 func TestWildcardMatch(t *testing.T) {
@@ -124,6 +1702,321 @@ func TestWildcardMatch(t *testing.T) {
 	}
 }
 
+func TestParseCommandsCount(t *testing.T) {
+	cmds, _, err := parseCommands(".", []string{"3*go test ./...", "npm start"}, parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds, err = uniqueNames(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range cmds {
+		got = append(got, c.name+"="+c.cmd)
+	}
+	want := []string{"go.1=go test ./...", "go.2=go test ./...", "go.3=go test ./...", "npm=npm start"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("parseCommands: got %v, want %v", got, want)
+	}
+
+	if _, _, err := parseCommands(".", []string{"0*echo"}, parseOptions{}); err == nil {
+		t.Fatal("parseCommands: expected error for zero count")
+	}
+}
+
+func TestParseCommandsNpx(t *testing.T) {
+	cmds, _, err := parseCommands(".", []string{"npx:concurrently echo a"}, parseOptions{npxArgs: []string{"--yes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].name != "concurrently" || cmds[0].cmd != "npx --yes concurrently echo a" {
+		t.Fatalf("parseCommands: got %+v", cmds)
+	}
+}
+
+func TestAddRaceFlag(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"go run ./cmd/api", "go run -race ./cmd/api"},
+		{"go test", "go test -race"},
+		{"go test -race ./...", "go test -race ./..."},
+		{"go test -v -race=true ./...", "go test -v -race=true ./..."},
+		{"go run . -race-mode=fast", "go run -race . -race-mode=fast"},
+		{"go test ./... && ./bin -race", "go test -race ./... && ./bin -race"},
+		{"go vet ./...", "go vet ./..."},
+		{"gofmt -l .", "gofmt -l ."},
+		{"npm run go run", "npm run go run"},
+	}
+	for _, tt := range tests {
+		if got := addRaceFlag(tt.input); got != tt.want {
+			t.Errorf("addRaceFlag(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"go run .", []string{"go", "run", "."}},
+		{"  echo   a  ", []string{"echo", "a"}},
+		{`echo "hello world" 'a b'`, []string{"echo", "hello world", "a b"}},
+		{`echo "a\"b" 'a\b' a\ b`, []string{"echo", `a"b`, `a\b`, "a b"}},
+		{`echo "a\nb" ""`, []string{"echo", `a\nb`, ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.input)
+		if err != nil {
+			t.Errorf("splitArgs(%q): %v", tt.input, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "echo 'a", `echo "a`, `echo a\`} {
+		if _, err := splitArgs(input); err == nil {
+			t.Errorf("splitArgs(%q): expected error", input)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	pm := MustNew(Config{Cmds: []string{`printf '%s\n' "a  b" && sleep 0.1`}, Exec: true, Silent: true})
+	if got := pm.procs[0].Args; !slices.Equal(got, []string{"printf", "%s\\n", "a  b", "&&", "sleep", "0.1"}) {
+		t.Fatalf("Exec: got args %q", got)
+	}
+
+	if _, err := New(Config{Cmds: []string{"npm:dev"}, Exec: true}); err == nil {
+		t.Fatal("New: expected error for npm script with Exec")
+	}
+}
+
+func TestParseCommandsBun(t *testing.T) {
+	root := t.TempDir()
+	pkg := `{"scripts": {"dev:js": "vite", "dev:css": "tailwindcss -w", "build": "vite build"}}`
+	if err := os.WriteFile(filepath.Join(root, "package.json"), []byte(pkg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds, _, err := parseCommands(root, []string{"bun:dev:*", "npm:build"}, parseOptions{bunArgs: []string{"--silent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range cmds {
+		got = append(got, c.name+"="+c.cmd)
+	}
+	sort.Strings(got)
+	want := []string{"build=vite build", "dev:css=bun run --silent dev:css", "dev:js=bun run --silent dev:js"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("parseCommands: got %v, want %v", got, want)
+	}
+}
+
+func TestParseCommandsParentPackageJSON(t *testing.T) {
+	root := t.TempDir()
+	pkg := filepath.Join(root, "packages", "web")
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pkgPath := filepath.Join(root, "package.json")
+	if err := os.WriteFile(pkgPath, []byte(`{"scripts": {"dev": "echo 'dev'"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds, path, err := parseCommands(pkg, []string{"npm:dev"}, parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != pkgPath || len(cmds) != 1 || cmds[0].dir != root {
+		t.Fatalf("parseCommands: got %+v from %q", cmds, path)
+	}
+
+	_, _, err = parseCommands(pkg, []string{"npm:dev"}, parseOptions{noPackageJSONWalk: true})
+	if err == nil {
+		t.Fatal("parseCommands: expected error when not walking up to package.json")
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	cmds := []command{
+		{name: "echo.1", explicit: true},
+		{name: "echo"},
+		{name: "web", explicit: true},
+		{name: "web"},
+		{name: "api"},
+		{name: "echo"},
+		{name: "echo.2"},
+	}
+	got, err := uniqueNames(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range got {
+		names = append(names, c.name)
+	}
+	want := []string{"echo.1", "echo.3", "web", "web.1", "api", "echo.4", "echo.2"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("uniqueNames: got %v, want %v", names, want)
+	}
+
+	_, err = uniqueNames([]command{{name: "api", explicit: true}, {name: "api", explicit: true}})
+	if err == nil {
+		t.Fatal("uniqueNames: expected error for duplicate explicit names")
+	}
+}
+
+func TestParseCmdColor(t *testing.T) {
+	tests := []struct {
+		input   string
+		color   int
+		custom  bool
+		cmd     string
+		wantErr bool
+	}{
+		{"node api.js", 0, false, "node api.js", false},
+		{"color(196):node api.js", 196, true, "node api.js", false},
+		{"color(0): node api.js", 0, true, "node api.js", false},
+		{"color(256):node api.js", 0, false, "", true},
+		{"color(red):node api.js", 0, false, "", true},
+		{"color(12)node api.js", 0, false, "", true},
+	}
+
+	for _, tt := range tests {
+		color, custom, cmd, err := parseCmdColor(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseCmdColor(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+		}
+		if color != tt.color || custom != tt.custom || cmd != tt.cmd {
+			t.Errorf("parseCmdColor(%q) = %d, %v, %q, want %d, %v, %q", tt.input, color, custom, cmd, tt.color, tt.custom, tt.cmd)
+		}
+	}
+}
+
+func TestParseCmdPrefixes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    cmdPrefixes
+		cmd     string
+		wantErr bool
+	}{
+		{"node api.js", cmdPrefixes{count: 1}, "node api.js", false},
+		{"2*color(196):node api.js", cmdPrefixes{count: 2, color: 196, customColor: true}, "node api.js", false},
+		{"env-file(.env):color(3):node api.js", cmdPrefixes{count: 1, color: 3, customColor: true, envFile: ".env"}, "node api.js", false},
+		{"color(3):3*user(www):env-file(.env):node api.js", cmdPrefixes{count: 3, color: 3, customColor: true, user: "www", envFile: ".env"}, "node api.js", false},
+		{"color(3):socket:unix:/tmp/app.sock:app", cmdPrefixes{count: 1, color: 3, customColor: true, socket: &socketAddr{network: "unix", address: "/tmp/app.sock"}}, "app", false},
+		{"color(3):color(4):node api.js", cmdPrefixes{}, "", true},
+		{"user(www):color(red):node api.js", cmdPrefixes{}, "", true},
+	}
+
+	for _, tt := range tests {
+		got, cmd, err := parseCmdPrefixes(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseCmdPrefixes(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) || cmd != tt.cmd {
+			t.Errorf("parseCmdPrefixes(%q) = %+v, %q, want %+v, %q", tt.input, got, cmd, tt.want, tt.cmd)
+		}
+	}
+}
+
+func TestColorPalette(t *testing.T) {
+	t.Setenv("TANDEM_COLORS", "1, 9,10")
+	got, err := colorPalette(nil, io.Discard)
+	if err != nil || !slices.Equal(got, []int{1, 9, 10}) {
+		t.Fatalf("colorPalette() with TANDEM_COLORS = %v, %v", got, err)
+	}
+	if got, _ := colorPalette([]int{42}, io.Discard); !slices.Equal(got, []int{42}) {
+		t.Fatalf("colorPalette() with custom colors = %v, want [42]", got)
+	}
+	if _, err := colorPalette([]int{256}, io.Discard); err == nil {
+		t.Fatal("colorPalette(): expected error for invalid custom color")
+	}
+
+	t.Setenv("TANDEM_COLORS", "1,300")
+	var warn bytes.Buffer
+	if got, _ := colorPalette(nil, &warn); !slices.Equal(got, colors) {
+		t.Fatalf("colorPalette() with invalid TANDEM_COLORS = %v, want default", got)
+	}
+	if !strings.Contains(warn.String(), "tandem: warning: ignoring TANDEM_COLORS") {
+		t.Fatalf("colorPalette(): expected a warning for invalid TANDEM_COLORS, got %q", warn.String())
+	}
+}
+
+func TestFindNodeBins(t *testing.T) {
+	root := t.TempDir()
+	pkg := filepath.Join(root, "packages", "web")
+	for _, dir := range []string{root, pkg} {
+		if err := os.MkdirAll(filepath.Join(dir, "node_modules", ".bin"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := findNodeBins(pkg, root)
+	want := []string{
+		filepath.Join(pkg, "node_modules", ".bin"),
+		filepath.Join(root, "node_modules", ".bin"),
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("findNodeBins(%q, %q) = %v, want %v", pkg, root, got, want)
+	}
+}
+
+func TestDisableNodeBin(t *testing.T) {
+	root := t.TempDir()
+	bin := filepath.Join(root, "node_modules", ".bin")
+	if err := os.MkdirAll(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		disable bool
+		wantBin bool
+	}{
+		{false, true},
+		{true, false},
+	}
+	for _, tt := range tests {
+		pm, err := New(Config{Root: root, Cmds: []string{"true"}, DisableNodeBin: tt.disable})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var path string
+		for _, kv := range pm.processes()[0].Env {
+			if strings.HasPrefix(kv, "PATH=") {
+				path = strings.TrimPrefix(kv, "PATH=")
+			}
+		}
+		got := slices.Contains(filepath.SplitList(path), bin)
+		if got != tt.wantBin {
+			t.Errorf("DisableNodeBin %v: got node_modules/.bin in PATH %v, want %v (PATH=%q)", tt.disable, got, tt.wantBin, path)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		input time.Duration
+		want  string
+	}{
+		{450 * time.Millisecond, "450ms"},
+		{12300 * time.Millisecond, "12.3s"},
+		{150 * time.Second, "2.5m"},
+	}
+
+	for _, tt := range tests {
+		got := formatDuration(tt.input)
+		if got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
 func captureStdout(f func()) (string, error) {
 	stdout := os.Stdout
 	r, w, err := os.Pipe()
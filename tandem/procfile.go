@@ -0,0 +1,72 @@
+package tandem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// procfileEntry matches a "name: command" line in a Procfile.
+var procfileEntry = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// NewFromProcfile creates a process manager for the processes in the Procfile
+// at path, along with any already in opts. Comment lines directly above an
+// entry become its description. If opts.Root isn't set, commands run from the
+// directory containing the Procfile.
+func NewFromProcfile(path string, opts Config) (*ProcessManager, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, configErrorf(ErrKindBadProcfile, "reading Procfile: %v", err)
+	}
+	defer f.Close()
+	procs, err := parseProcfile(f)
+	if err != nil {
+		return nil, configErrorf(ErrKindBadProcfile, "parsing %s: %v", filepath.Base(path), err)
+	}
+	if opts.Root == "" {
+		opts.Root = filepath.Dir(path)
+	}
+	opts.Processes = append(append([]ProcessConfig(nil), opts.Processes...), procs...)
+	return New(opts)
+}
+
+// parseProcfile parses the "name: command" entries of a Procfile. Blank lines
+// and lines starting with '#' are skipped, but comments directly above an
+// entry are kept as its description.
+func parseProcfile(r io.Reader) ([]ProcessConfig, error) {
+	var procs []ProcessConfig
+	var comments []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			comments = nil
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+			continue
+		}
+		m := procfileEntry.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected name: command, got %q", n, line)
+		}
+		procs = append(procs, ProcessConfig{
+			Name:        m[1],
+			Cmd:         strings.TrimSpace(m[2]),
+			Description: strings.Join(comments, " "),
+		})
+		comments = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(procs) == 0 {
+		return nil, fmt.Errorf("no processes defined")
+	}
+	return procs, nil
+}
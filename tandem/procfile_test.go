@@ -0,0 +1,66 @@
+package tandem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rosszurowski/tandem/ansi"
+)
+
+func TestParseProcfile(t *testing.T) {
+	procs, err := parseProcfile(strings.NewReader(`
+# The main web server
+web: gunicorn app:app
+
+# Not attached to anything
+
+worker:   python worker.py
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("got %d processes, want 2", len(procs))
+	}
+	if p := procs[0]; p.Name != "web" || p.Cmd != "gunicorn app:app" || p.Description != "The main web server" {
+		t.Errorf("got unexpected process %+v", p)
+	}
+	if p := procs[1]; p.Name != "worker" || p.Cmd != "python worker.py" || p.Description != "" {
+		t.Errorf("got unexpected process %+v", p)
+	}
+
+	if _, err := parseProcfile(strings.NewReader("web gunicorn\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected a parse error for line 1, got %v", err)
+	}
+}
+
+func TestNewFromProcfile(t *testing.T) {
+	ansi.NoColor = true
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Procfile")
+	err := os.WriteFile(path, []byte("web: echo web=$PORT && sleep 0.1\napi: echo api=$PORT && sleep 0.1\nworker: sleep 5\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm, err := NewFromProcfile(path, Config{Exclude: []string{"worker"}, BasePort: 5000, Silent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "web=5000") || !strings.Contains(out, "api=5001") {
+		t.Fatalf("expected ports to be assigned in order, got %q", out)
+	}
+
+	_, err = NewFromProcfile(filepath.Join(dir, "missing"), Config{})
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Kind != ErrKindBadProcfile {
+		t.Fatalf("expected a bad Procfile error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package tandem
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// killSignals are the signals that can be used to kill processes once their
+// timeout is up.
+var killSignals = []namedSignal{
+	{"SIGKILL", syscall.SIGKILL},
+	{"SIGTERM", syscall.SIGTERM},
+	{"SIGQUIT", syscall.SIGQUIT},
+}
+
+// interruptSignals are the signals that can be used to ask processes to exit
+// gracefully.
+var interruptSignals = []namedSignal{
+	{"SIGINT", syscall.SIGINT},
+	{"SIGTERM", syscall.SIGTERM},
+	{"SIGQUIT", syscall.SIGQUIT},
+	{"SIGHUP", syscall.SIGHUP},
+	{"SIGUSR1", syscall.SIGUSR1},
+	{"SIGUSR2", syscall.SIGUSR2},
+}
+
+type namedSignal struct {
+	name string
+	sig  syscall.Signal
+}
+
+// ParseKillSignal parses the name of a signal used to kill processes, like
+// "SIGTERM" or "TERM". An empty name returns SIGKILL.
+func ParseKillSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGKILL, nil
+	}
+	return parseSignal(name, killSignals)
+}
+
+// ParseInterruptSignal parses the name of a signal used to ask processes to
+// exit gracefully, like "SIGTERM" or "TERM". An empty name returns SIGINT.
+func ParseInterruptSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGINT, nil
+	}
+	return parseSignal(name, interruptSignals)
+}
+
+func parseSignal(name string, valid []namedSignal) (syscall.Signal, error) {
+	upper := strings.ToUpper(name)
+	if !strings.HasPrefix(upper, "SIG") {
+		upper = "SIG" + upper
+	}
+	var names []string
+	for _, s := range valid {
+		if s.name == upper {
+			return s.sig, nil
+		}
+		names = append(names, s.name)
+	}
+	return 0, fmt.Errorf("invalid signal %q, expected one of %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,33 @@
+package tandem
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignals(t *testing.T) {
+	tests := []struct {
+		parse   func(string) (syscall.Signal, error)
+		input   string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{ParseKillSignal, "", syscall.SIGKILL, false},
+		{ParseKillSignal, "SIGTERM", syscall.SIGTERM, false},
+		{ParseKillSignal, "quit", syscall.SIGQUIT, false},
+		{ParseKillSignal, "SIGUSR1", 0, true},
+		{ParseInterruptSignal, "", syscall.SIGINT, false},
+		{ParseInterruptSignal, "USR1", syscall.SIGUSR1, false},
+		{ParseInterruptSignal, "SIGKILL", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parsing %q: got error %v, want error %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parsing %q: got %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
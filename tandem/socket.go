@@ -0,0 +1,73 @@
+package tandem
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// socketAddr is a socket that a process's stdin and stdout are connected to,
+// rather than its terminal.
+type socketAddr struct {
+	network string // "unix" or "tcp"
+	address string
+}
+
+func (a socketAddr) String() string {
+	return a.network + ":" + a.address
+}
+
+// dial connects to the socket, returning a file for the connection that can
+// be passed to a process.
+func (a socketAddr) dial() (*os.File, error) {
+	conn, err := net.Dial(a.network, a.address)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to socket %s: %v", a, err)
+	}
+	defer conn.Close()
+	f, err := conn.(interface{ File() (*os.File, error) }).File()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't use socket %s: %v", a, err)
+	}
+	return f, nil
+}
+
+// parseCmdSocket parses an optional "socket:" prefix from a command, which
+// connects the command's stdin and stdout to a socket, like
+// "socket:unix:/tmp/app.sock:app" or "socket:tcp:localhost:9000:app". It
+// returns the socket, if one was given, and the command with the prefix
+// removed.
+func parseCmdSocket(cmd string) (*socketAddr, string, error) {
+	s := strings.TrimSpace(cmd)
+	if !strings.HasPrefix(s, "socket:") {
+		return nil, cmd, nil
+	}
+	invalid := fmt.Errorf("invalid socket prefix in %q, expected socket:unix:<path>:<command> or socket:tcp:<host>:<port>:<command>", cmd)
+	network, rest, _ := strings.Cut(strings.TrimPrefix(s, "socket:"), ":")
+	var address string
+	switch network {
+	case "unix":
+		var ok bool
+		if address, rest, ok = strings.Cut(rest, ":"); !ok {
+			return nil, "", invalid
+		}
+	case "tcp":
+		host, rest2, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, "", invalid
+		}
+		port, rest3, ok := strings.Cut(rest2, ":")
+		if !ok || port == "" {
+			return nil, "", invalid
+		}
+		address, rest = net.JoinHostPort(host, port), rest3
+	default:
+		return nil, "", invalid
+	}
+	rest = strings.TrimSpace(rest)
+	if address == "" || rest == "" {
+		return nil, "", invalid
+	}
+	return &socketAddr{network: network, address: address}, rest, nil
+}
@@ -0,0 +1,89 @@
+package tandem
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rosszurowski/tandem/ansi"
+)
+
+func TestParseCmdSocket(t *testing.T) {
+	tests := []struct {
+		input   string
+		addr    string
+		cmd     string
+		wantErr bool
+	}{
+		{"node server.js", "", "node server.js", false},
+		{"socket:unix:/tmp/app.sock:node server.js", "unix:/tmp/app.sock", "node server.js", false},
+		{"socket:tcp:localhost:9000:node server.js", "tcp:localhost:9000", "node server.js", false},
+		{"socket:tcp::9000: node server.js", "tcp::9000", "node server.js", false},
+		{"socket:unix:/tmp/app.sock", "", "", true},
+		{"socket:tcp:localhost:node server.js", "", "", true},
+		{"socket:udp:localhost:9000:node server.js", "", "", true},
+		{"socket:unix::node server.js", "", "", true},
+	}
+
+	for _, tt := range tests {
+		addr, cmd, err := parseCmdSocket(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseCmdSocket(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+		}
+		got := ""
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != tt.addr || cmd != tt.cmd {
+			t.Errorf("parseCmdSocket(%q) = %q, %q, want %q, %q", tt.input, got, cmd, tt.addr, tt.cmd)
+		}
+	}
+}
+
+func TestSocketPrefix(t *testing.T) {
+	ansi.NoColor = true
+	path := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	reply := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			reply <- err.Error()
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("ping\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		reply <- line
+	}()
+
+	pm := MustNew(Config{
+		Cmds:   []string{"socket:unix:" + path + ":read line && echo got $line && echo logged >&2 && sleep 0.1"},
+		Silent: true,
+	})
+	out, err := captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-reply; got != "got ping\n" {
+		t.Fatalf("expected process to reply over the socket, got %q", got)
+	}
+	if !strings.Contains(out, "logged") || strings.Contains(out, "got ping") {
+		t.Fatalf("expected only stderr in the output, got %q", out)
+	}
+
+	pm = MustNew(Config{Cmds: []string{"socket:unix:" + path + ".missing:echo hi"}, Silent: true})
+	out, err = captureStdout(pm.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "couldn't connect to socket unix:"+path+".missing") {
+		t.Fatalf("expected a connection error, got %q", out)
+	}
+}
@@ -0,0 +1,133 @@
+package tandem
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Capabilities needed to run a process as another user.
+const (
+	capSetgid = 6
+	capSetuid = 7
+)
+
+// lookupCredential returns the credential to run a process as the given user,
+// which may be a username or a numeric user ID. It returns an error if the
+// user doesn't exist, or if tandem isn't allowed to switch to them.
+func lookupCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID %q for user %q", u.Uid, name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group ID %q for user %q", u.Gid, name)
+	}
+	if int(uid) != os.Geteuid() && !canSetUser() {
+		return nil, fmt.Errorf("running commands as user %q needs tandem to run as root or with CAP_SETUID", name)
+	}
+
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	if !canSetUser() {
+		// This is the current user, whose groups can't be set without
+		// privileges, so they're left as they are.
+		cred.NoSetGroups = true
+		return cred, nil
+	}
+	// If the user's other groups can't be found, they only get their primary
+	// group.
+	groupIDs, _ := u.GroupIds()
+	for _, id := range groupIDs {
+		if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+			cred.Groups = append(cred.Groups, uint32(g))
+		}
+	}
+	return cred, nil
+}
+
+// canSetUser reports whether the current process can change its user and
+// group IDs. Outside Linux, capabilities can't be checked, so only root is
+// assumed to be able to.
+func canSetUser() bool {
+	if os.Geteuid() == 0 {
+		return true
+	}
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false
+		}
+		return caps&(1<<capSetuid) != 0 && caps&(1<<capSetgid) != 0
+	}
+	return false
+}
+
+// UserShell returns the current user's preferred shell, from the SHELL
+// environment variable or else their entry in /etc/passwd. If neither is set,
+// it returns /bin/sh.
+func UserShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if u, err := user.Current(); err == nil {
+		if shell := passwdShell(u.Uid); shell != "" {
+			return shell
+		}
+	}
+	return defaultShell
+}
+
+// passwdShell returns the login shell for the given user ID from
+// /etc/passwd, or an empty string if it can't be found.
+func passwdShell(uid string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Entries look like name:password:uid:gid:info:home:shell.
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[2] == uid {
+			return fields[6]
+		}
+	}
+	return ""
+}
+
+// parseCmdUser parses an optional "user(name):" prefix from a command, which
+// runs the command as the given user. It returns the user, if one was given,
+// and the command with the prefix removed.
+func parseCmdUser(cmd string) (string, string, error) {
+	s := strings.TrimSpace(cmd)
+	if !strings.HasPrefix(s, "user(") {
+		return "", cmd, nil
+	}
+	name, rest, ok := strings.Cut(strings.TrimPrefix(s, "user("), "):")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid user prefix in %q, expected user(<name>):<command>", cmd)
+	}
+	return name, strings.TrimSpace(rest), nil
+}
@@ -0,0 +1,89 @@
+package tandem
+
+import (
+	"bytes"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rosszurowski/tandem/ansi"
+)
+
+func TestParseCmdUser(t *testing.T) {
+	tests := []struct {
+		input   string
+		user    string
+		cmd     string
+		wantErr bool
+	}{
+		{"node api.js", "", "node api.js", false},
+		{"user(www-data):node api.js", "www-data", "node api.js", false},
+		{"user(1000): node api.js", "1000", "node api.js", false},
+		{"user():node api.js", "", "", true},
+		{"user(www-data)node api.js", "", "", true},
+	}
+
+	for _, tt := range tests {
+		u, cmd, err := parseCmdUser(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseCmdUser(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+		}
+		if u != tt.user || cmd != tt.cmd {
+			t.Errorf("parseCmdUser(%q) = %q, %q, want %q, %q", tt.input, u, cmd, tt.user, tt.cmd)
+		}
+	}
+}
+
+func TestLookupCredential(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	cred, err := lookupCredential(current.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strconv.Itoa(int(cred.Uid)) != current.Uid {
+		t.Errorf("got uid %d, want %s", cred.Uid, current.Uid)
+	}
+	if !canSetUser() && (!cred.NoSetGroups || len(cred.Groups) > 0) {
+		t.Errorf("expected groups not to be set without privileges, got %+v", cred)
+	}
+
+	_, err = New(Config{Cmds: []string{"user(tandem-no-such-user):true"}})
+	if err == nil || !strings.Contains(err.Error(), `unknown user "tandem-no-such-user"`) {
+		t.Errorf("expected an unknown user error, got %v", err)
+	}
+}
+
+func TestRunAsCurrentUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	ansi.NoColor = true
+	var buf bytes.Buffer
+	pm, err := NewWithWriter(Config{
+		Processes: []ProcessConfig{{Name: "id", Cmd: "echo uid=$(id -u) && sleep 0.1", User: current.Username}},
+		Silent:    true,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.Run()
+	if want := "uid=" + current.Uid; !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected output to contain %q, got %q", want, buf.String())
+	}
+}
+
+func TestUserShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/zsh")
+	if got := UserShell(); got != "/bin/zsh" {
+		t.Errorf("UserShell() = %q, want /bin/zsh", got)
+	}
+	t.Setenv("SHELL", "")
+	if got := UserShell(); got == "" {
+		t.Error("UserShell() returned an empty shell")
+	}
+}
@@ -0,0 +1,136 @@
+package tandem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validate checks the configuration for mistakes without running anything or
+// reading package.json, so a configuration can be checked before it's used.
+// It reports every problem it finds rather than only the first; each is a
+// *ConfigError, which can be found with errors.As.
+//
+// New checks everything Validate does, and more, so it's never necessary to
+// call Validate before New.
+func (cfg Config) Validate() error {
+	var errs []error
+	if len(cfg.Cmds) == 0 && len(cfg.Processes) == 0 {
+		errs = append(errs, configErrorf(ErrKindInvalidOption, "no commands or processes given"))
+	}
+	if _, err := resolveRoot(cfg.Root); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.Timeout < 0 {
+		errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid timeout %d, expected 0 or more seconds", cfg.Timeout))
+	}
+	if cfg.KillTimeout < 0 {
+		errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid kill timeout %d, expected 0 or more seconds", cfg.KillTimeout))
+	}
+	for name, t := range cfg.Timeouts {
+		if t < 0 {
+			errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid timeout %d for %q, expected 0 or more seconds", t, name))
+		}
+	}
+
+	for _, code := range cfg.IgnoreExitCodes {
+		if code < 0 || code > 255 {
+			errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid exit code %d to ignore, expected a number from 0 to 255", code))
+		}
+	}
+
+	if _, err := ParseKillSignal(cfg.KillSignal); err != nil {
+		errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid kill signal: %v", err))
+	}
+	if _, err := ParseInterruptSignal(cfg.InterruptSignal); err != nil {
+		errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid interrupt signal: %v", err))
+	}
+
+	names := map[string]bool{}
+	for _, pc := range cfg.Processes {
+		if _, err := pc.command(); err != nil {
+			errs = append(errs, configErrorf(ErrKindInvalidOption, "%v", err))
+		}
+		if pc.Name != "" {
+			if names[pc.Name] {
+				errs = append(errs, configErrorf(ErrKindInvalidOption, "multiple processes named %q", pc.Name))
+			}
+			names[pc.Name] = true
+		}
+		if _, err := ParseKillSignal(pc.KillSignal); err != nil {
+			errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid kill signal for %q: %v", pc.Name, err))
+		}
+		if _, err := ParseInterruptSignal(pc.InterruptSignal); err != nil {
+			errs = append(errs, configErrorf(ErrKindInvalidOption, "invalid interrupt signal for %q: %v", pc.Name, err))
+		}
+	}
+	return joinErrors(errs)
+}
+
+// resolveRoot returns the absolute path of a root directory, checking that
+// it exists.
+func resolveRoot(dir string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", configErrorf(ErrKindBadDirectory, "could not get absolute path for directory: %v", err)
+	}
+	if info, err := os.Stat(root); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", configErrorf(ErrKindBadDirectory, "directory %q does not exist", root)
+		}
+		return "", configErrorf(ErrKindBadDirectory, "reading directory: %v", err)
+	} else if !info.IsDir() {
+		return "", configErrorf(ErrKindBadDirectory, "%q is not a directory", root)
+	}
+	return root, nil
+}
+
+// multiError is a list of errors, like those returned by errors.Join, which
+// needs a newer version of Go than tandem supports. errors.Is and errors.As
+// only follow Unwrap() []error from Go 1.20, so it also has Is and As
+// methods that check each error in turn.
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+func (e multiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e multiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors returns nil if there are no errors, the error itself if there's
+// only one, and a multiError otherwise.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return multiError(errs)
+}
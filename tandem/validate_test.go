@@ -0,0 +1,66 @@
+package tandem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	root := t.TempDir()
+	if err := (Config{Root: root, Cmds: []string{"echo"}}).Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	err := Config{
+		Root:       filepath.Join(root, "missing"),
+		Timeout:    -1,
+		KillSignal: "SIGNOPE",
+		Processes: []ProcessConfig{
+			{Name: "api", Cmd: "go run ."},
+			{Name: "api", Cmd: "go run ./other"},
+		},
+	}.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"does not exist", "invalid timeout -1", "invalid kill signal", `multiple processes named "api"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err)
+		}
+	}
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Kind != ErrKindBadDirectory {
+		t.Errorf("expected the first error to be a bad directory ConfigError, got %v", err)
+	}
+
+	if err := (Config{Root: root}).Validate(); err == nil || !strings.Contains(err.Error(), "no commands") {
+		t.Errorf("expected an error for no commands, got %v", err)
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	err := joinErrors([]error{
+		fmt.Errorf("checking: %w", os.ErrNotExist),
+		configErrorf(ErrKindBadEnvFile, "reading env file"),
+	})
+	e, ok := err.(multiError)
+	if !ok {
+		t.Fatalf("expected a multiError, got %T", err)
+	}
+	// Call the methods directly, since on Go 1.20 and later, errors.Is and
+	// errors.As would find these through Unwrap anyway.
+	if !e.Is(os.ErrNotExist) || e.Is(os.ErrExist) {
+		t.Error("expected Is to match only the wrapped errors")
+	}
+	var configErr *ConfigError
+	if !e.As(&configErr) || configErr.Kind != ErrKindBadEnvFile {
+		t.Errorf("expected As to find the ConfigError, got %v", configErr)
+	}
+	if err := joinErrors([]error{os.ErrNotExist}); err != os.ErrNotExist {
+		t.Errorf("expected a single error to be returned as is, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package tandem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workspacePrefix marks commands that run a script in each matching workspace
+// package, like "workspace:*:dev".
+const workspacePrefix = "workspace:"
+
+// isWorkspaceCmd reports whether a command refers to workspace scripts.
+func isWorkspaceCmd(cmd string) bool {
+	return strings.HasPrefix(strings.TrimSpace(cmd), workspacePrefix)
+}
+
+// parseWorkspaceCmd splits a "workspace:<pattern>:<script>" command into the
+// pattern matching workspace names and the script to run in each.
+func parseWorkspaceCmd(cmd string) (pattern, script string, err error) {
+	s := strings.TrimPrefix(strings.TrimSpace(cmd), workspacePrefix)
+	pattern, script, ok := strings.Cut(s, ":")
+	if !ok || pattern == "" || script == "" {
+		return "", "", fmt.Errorf("invalid workspace command %q, expected workspace:<name>:<script>", cmd)
+	}
+	return pattern, script, nil
+}
+
+// workspacesField is the workspaces field of a package.json file, which is
+// either a list of globs, or an object with a list under "packages".
+type workspacesField []string
+
+func (w *workspacesField) UnmarshalJSON(b []byte) error {
+	var globs []string
+	if err := json.Unmarshal(b, &globs); err == nil {
+		*w = globs
+		return nil
+	}
+	var obj struct {
+		Packages []string `json:"packages"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return fmt.Errorf("workspaces must be a list of paths or an object with packages")
+	}
+	*w = obj.Packages
+	return nil
+}
+
+// findWorkspaces returns the directories of the workspace packages listed in
+// the package.json at pkgPath, in order. Globs that match directories without
+// a package.json are ignored.
+func findWorkspaces(pkgPath string) ([]string, error) {
+	b, err := os.ReadFile(pkgPath)
+	if err != nil {
+		return nil, configErrorf(ErrKindBadPackageJSON, "reading package.json: %v", err)
+	}
+	var pkg struct {
+		Workspaces workspacesField `json:"workspaces"`
+	}
+	if err := json.Unmarshal(b, &pkg); err != nil {
+		return nil, configErrorf(ErrKindBadPackageJSON, "parsing package.json: %v", err)
+	}
+
+	root := filepath.Dir(pkgPath)
+	seen := map[string]bool{}
+	var dirs []string
+	for _, glob := range pkg.Workspaces {
+		matches, err := filepath.Glob(filepath.Join(root, glob))
+		if err != nil {
+			return nil, configErrorf(ErrKindBadPackageJSON, "invalid workspace pattern %q: %v", glob, err)
+		}
+		for _, dir := range matches {
+			if seen[dir] {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, "package.json")); err != nil {
+				continue
+			}
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+// parseWorkspaceScripts returns a command for each workspace package matching
+// each of the given workspace commands. Commands are named after the
+// workspace's directory and the script, like "api:dev". Workspaces missing
+// the script are an error, unless skipMissing is set, in which case they're
+// skipped with a warning written to warn, if it's set.
+func parseWorkspaceScripts(pkgPath string, cmds []string, skipMissing bool, warn io.Writer) ([]command, error) {
+	dirs, err := findWorkspaces(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	type workspaceCmd struct {
+		pattern, script string
+	}
+	parsed := make([]workspaceCmd, len(cmds))
+	needed := make([]bool, len(dirs)) // Workspaces matched by any command
+	for i, cmd := range cmds {
+		pattern, script, err := parseWorkspaceCmd(cmd)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = workspaceCmd{pattern, script}
+		for j, dir := range dirs {
+			if wildcardMatch(pattern, filepath.Base(dir)) {
+				needed[j] = true
+			}
+		}
+	}
+	pkgs, err := readWorkspacePackages(dirs, needed)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []command
+	for _, cmd := range parsed {
+		matched := false
+		for i, dir := range dirs {
+			name := filepath.Base(dir)
+			if !wildcardMatch(cmd.pattern, name) {
+				continue
+			}
+			matched = true
+			s, ok := pkgs[i].Scripts[cmd.script]
+			if !ok {
+				if skipMissing {
+					if warn != nil {
+						fmt.Fprintf(warn, "tandem: warning: workspace %q has no %q script, skipping\n", name, cmd.script)
+					}
+					continue
+				}
+				return nil, configErrorf(ErrKindMissingScript, "workspace %q has no %q script", name, cmd.script)
+			}
+			result = append(result, command{name: name + ":" + cmd.script, cmd: s, dir: dir})
+		}
+		if !matched {
+			return nil, configErrorf(ErrKindMissingScript, "no workspaces matching %q found in package.json", cmd.pattern)
+		}
+	}
+	return result, nil
+}
+
+// readWorkspacePackages reads the package.json of each needed workspace in
+// dirs in parallel, since monorepos can have many. Packages are returned in
+// the same order as dirs, and the first error in that order is returned.
+func readWorkspacePackages(dirs []string, needed []bool) ([]packageJSON, error) {
+	pkgs := make([]packageJSON, len(dirs))
+	err := parallel(len(dirs), func(i int) error {
+		if !needed[i] {
+			return nil
+		}
+		name := filepath.Base(dirs[i])
+		b, err := os.ReadFile(filepath.Join(dirs[i], "package.json"))
+		if err != nil {
+			return configErrorf(ErrKindBadPackageJSON, "reading package.json for workspace %q: %v", name, err)
+		}
+		if err := json.Unmarshal(b, &pkgs[i]); err != nil {
+			return configErrorf(ErrKindBadPackageJSON, "parsing package.json for workspace %q: %v", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,105 @@
+package tandem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkspaceScripts(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "package.json"), `{"workspaces": ["packages/*"]}`)
+	writeFile(t, filepath.Join(root, "packages/api/package.json"), `{"scripts": {"dev": "node api.js"}}`)
+	writeFile(t, filepath.Join(root, "packages/web/package.json"), `{"scripts": {"dev": "vite"}}`)
+	writeFile(t, filepath.Join(root, "packages/docs/package.json"), `{"scripts": {"build": "docs"}}`)
+	if err := os.MkdirAll(filepath.Join(root, "packages/empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New(Config{Root: root, Cmds: []string{"workspace:*:dev"}})
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Kind != ErrKindMissingScript {
+		t.Fatalf("expected a missing script error for docs, got %v", err)
+	}
+
+	pm, err := New(Config{Root: root, Cmds: []string{"workspace:*:dev"}, SkipMissingWorkspaceScripts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pm.Names(), []string{"api:dev", "web:dev"}; !slices.Equal(got, want) {
+		t.Fatalf("got names %v, want %v", got, want)
+	}
+	if dir := pm.procs[0].Dir; dir != filepath.Join(root, "packages/api") {
+		t.Errorf("got dir %q, want the api workspace", dir)
+	}
+
+	pm, err = New(Config{Root: root, Cmds: []string{"workspace:web:dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pm.Names(), []string{"web:dev"}; !slices.Equal(got, want) {
+		t.Fatalf("got names %v, want %v", got, want)
+	}
+}
+
+func TestReadWorkspacePackages(t *testing.T) {
+	root := t.TempDir()
+	var dirs []string
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%02d", i))
+		writeFile(t, filepath.Join(dir, "package.json"), fmt.Sprintf(`{"scripts": {"dev": "dev %d"}}`, i))
+		dirs = append(dirs, dir)
+	}
+	broken := filepath.Join(root, "broken")
+	writeFile(t, filepath.Join(broken, "package.json"), `{`)
+	dirs = append(dirs, broken)
+
+	needed := make([]bool, len(dirs))
+	for i := range dirs[:20] {
+		needed[i] = true
+	}
+	pkgs, err := readWorkspacePackages(dirs, needed)
+	if err != nil {
+		t.Fatalf("expected workspaces that aren't needed not to be read, got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if got, want := pkgs[i].Scripts["dev"], fmt.Sprintf("dev %d", i); got != want {
+			t.Fatalf("got script %q for pkg%02d, want %q", got, i, want)
+		}
+	}
+
+	needed[20] = true
+	_, err = readWorkspacePackages(dirs, needed)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Kind != ErrKindBadPackageJSON || !strings.Contains(err.Error(), `"broken"`) {
+		t.Fatalf("expected a bad package.json error for broken, got %v", err)
+	}
+}
+
+func TestWorkspacesField(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "package.json"), `{"workspaces": {"packages": ["apps/*"]}}`)
+	writeFile(t, filepath.Join(root, "apps/api/package.json"), `{}`)
+	dirs, err := findWorkspaces(filepath.Join(root, "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 1 || dirs[0] != filepath.Join(root, "apps/api") {
+		t.Fatalf("got workspaces %v, want [apps/api]", dirs)
+	}
+}